@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+// ACLHandler serves the administrative endpoints for the table lists and
+// role permissions
+type ACLHandler struct {
+	acl *security.ACLManager
+}
+
+func NewACLHandler(acl *security.ACLManager) *ACLHandler {
+	return &ACLHandler{acl: acl}
+}
+
+type ACLTableRequest struct {
+	Table string `json:"table"`
+}
+
+// Get returns the active whitelist, blacklist and role permissions
+func (h *ACLHandler) Get(w http.ResponseWriter, r *http.Request) {
+	SendJSON(w, r, http.StatusOK, h.acl.Current())
+}
+
+// Replace replaces the whole ACL
+func (h *ACLHandler) Replace(w http.ResponseWriter, r *http.Request) {
+	var acl security.ACL
+	if err := json.NewDecoder(r.Body).Decode(&acl); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+
+	h.update(w, r, func(current *security.ACL) {
+		*current = acl
+	})
+}
+
+// AddTable adds a table to the whitelist or blacklist named by the {list}
+// URL parameter
+func (h *ACLHandler) AddTable(w http.ResponseWriter, r *http.Request) {
+	list := chi.URLParam(r, "list")
+	if !isTableList(list) {
+		SendError(w, r, http.StatusNotFound, "Unknown list, use whitelist or blacklist", nil)
+		return
+	}
+
+	var req ACLTableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+	if req.Table == "" {
+		SendError(w, r, http.StatusBadRequest, "Table is required", nil)
+		return
+	}
+
+	h.update(w, r, func(acl *security.ACL) {
+		tables := tableList(acl, list)
+		for _, table := range *tables {
+			if table == req.Table {
+				return
+			}
+		}
+		*tables = append(*tables, req.Table)
+	})
+}
+
+// RemoveTable removes the {table} URL parameter from the whitelist or
+// blacklist
+func (h *ACLHandler) RemoveTable(w http.ResponseWriter, r *http.Request) {
+	list := chi.URLParam(r, "list")
+	if !isTableList(list) {
+		SendError(w, r, http.StatusNotFound, "Unknown list, use whitelist or blacklist", nil)
+		return
+	}
+	table := chi.URLParam(r, "table")
+
+	h.update(w, r, func(acl *security.ACL) {
+		tables := tableList(acl, list)
+		kept := (*tables)[:0]
+		for _, t := range *tables {
+			if t != table {
+				kept = append(kept, t)
+			}
+		}
+		*tables = kept
+	})
+}
+
+// SetRole replaces the table permissions of the {role} URL parameter. The
+// body maps table patterns to operations.
+func (h *ACLHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	role := strings.ToLower(chi.URLParam(r, "role"))
+
+	var perms map[string][]string
+	if err := json.NewDecoder(r.Body).Decode(&perms); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+
+	h.update(w, r, func(acl *security.ACL) {
+		if acl.Roles == nil {
+			acl.Roles = make(map[string]map[string][]string)
+		}
+		acl.Roles[role] = perms
+	})
+}
+
+// DeleteRole removes the permissions of the {role} URL parameter
+func (h *ACLHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role := strings.ToLower(chi.URLParam(r, "role"))
+
+	h.update(w, r, func(acl *security.ACL) {
+		delete(acl.Roles, role)
+	})
+}
+
+// Reload reads the config file and the ACL file again
+func (h *ACLHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.acl.Reload(); err != nil {
+		SendError(w, r, http.StatusInternalServerError, "Failed to reload access lists", err)
+		return
+	}
+
+	SendJSON(w, r, http.StatusOK, h.acl.Current())
+}
+
+func (h *ACLHandler) update(w http.ResponseWriter, r *http.Request, fn func(acl *security.ACL)) {
+	if err := h.acl.Update(fn); err != nil {
+		if errors.Is(err, security.ErrInvalidACL) {
+			SendError(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if errors.Is(err, security.ErrACLNotPersisted) {
+			SendError(w, r, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		// The change was not applied because it could not be saved
+		SendError(w, r, http.StatusInternalServerError, "Failed to save access lists", err)
+		return
+	}
+
+	SendJSON(w, r, http.StatusOK, h.acl.Current())
+}
+
+func isTableList(list string) bool {
+	return list == "whitelist" || list == "blacklist"
+}
+
+func tableList(acl *security.ACL, list string) *[]string {
+	if list == "whitelist" {
+		return &acl.Whitelist
+	}
+	return &acl.Blacklist
+}
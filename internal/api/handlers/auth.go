@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/auth"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+type AuthHandler struct {
+	users       *auth.UserStore
+	jwt         *security.JWTManager
+	revocations *security.Revocations
+}
+
+func NewAuthHandler(users *auth.UserStore, jwt *security.JWTManager, revocations *security.Revocations) *AuthHandler {
+	return &AuthHandler{
+		users:       users,
+		jwt:         jwt,
+		revocations: revocations,
+	}
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	// RefreshToken is revoked together with the access token when given
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// All revokes every token of the user
+	All bool `json:"all,omitempty"`
+}
+
+// RevokeRequest revokes a single token by ID or every token of a user
+// issued before now
+type RevokeRequest struct {
+	TokenID   string     `json:"jti,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    string     `json:"user_id,omitempty"`
+}
+
+// Login verifies the credentials and issues an access and a refresh token
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		SendError(w, r, http.StatusBadRequest, "Username and password are required", nil)
+		return
+	}
+
+	user, err := h.users.Authenticate(r.Context(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			SendError(w, r, http.StatusUnauthorized, "Invalid username or password", nil)
+			return
+		}
+		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
+		return
+	}
+
+	pair, err := h.jwt.GenerateTokenPair(user.ID, user.Username, user.Roles)
+	if err != nil {
+		SendError(w, r, http.StatusInternalServerError, "Failed to issue token", err)
+		return
+	}
+
+	SendJSON(w, r, http.StatusOK, pair)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The user is read
+// again so role changes and removed accounts take effect.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		SendError(w, r, http.StatusBadRequest, "Refresh token is required", nil)
+		return
+	}
+
+	claims, err := h.jwt.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		SendError(w, r, http.StatusUnauthorized, ErrUnauthorized, err)
+		return
+	}
+
+	revoked, err := h.revocations.IsRevoked(r.Context(), claims)
+	if err != nil {
+		SendError(w, r, http.StatusServiceUnavailable, "Token revocation check failed", err)
+		return
+	}
+	if revoked {
+		SendError(w, r, http.StatusUnauthorized, ErrUnauthorized, security.ErrTokenRevoked)
+		return
+	}
+
+	user, err := h.users.FindByID(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			SendError(w, r, http.StatusUnauthorized, ErrUnauthorized, err)
+			return
+		}
+		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
+		return
+	}
+
+	// Rotated refresh tokens are single use; of concurrent refreshes with
+	// the same token only the one consuming it gets a new pair
+	consumed, err := h.revocations.Consume(r.Context(), claims.ID, expiresAt(claims))
+	if err != nil {
+		SendError(w, r, http.StatusServiceUnavailable, "Token revocation failed", err)
+		return
+	}
+	if !consumed {
+		SendError(w, r, http.StatusUnauthorized, ErrUnauthorized, security.ErrTokenRevoked)
+		return
+	}
+
+	pair, err := h.jwt.GenerateTokenPair(user.ID, user.Username, user.Roles)
+	if err != nil {
+		SendError(w, r, http.StatusInternalServerError, "Failed to issue token", err)
+		return
+	}
+
+	SendJSON(w, r, http.StatusOK, pair)
+}
+
+// Logout revokes the caller's access token and, when given, its refresh
+// token. With "all" every token of the user issued so far is revoked.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := security.ClaimsFromContext(r.Context())
+	if !ok {
+		SendError(w, r, http.StatusUnauthorized, ErrUnauthorized, nil)
+		return
+	}
+
+	var req LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	if req.All {
+		if err := h.revocations.RevokeUser(ctx, claims.UserID, time.Now()); err != nil {
+			SendError(w, r, http.StatusInternalServerError, "Token revocation failed", err)
+			return
+		}
+	} else {
+		if err := h.revocations.Revoke(ctx, claims.ID, expiresAt(claims)); err != nil {
+			SendError(w, r, http.StatusInternalServerError, "Token revocation failed", err)
+			return
+		}
+
+		if req.RefreshToken != "" {
+			refresh, err := h.jwt.ValidateRefreshToken(req.RefreshToken)
+			if err != nil || refresh.UserID != claims.UserID {
+				SendError(w, r, http.StatusBadRequest, "Invalid refresh token", err)
+				return
+			}
+			if err := h.revocations.Revoke(ctx, refresh.ID, expiresAt(refresh)); err != nil {
+				SendError(w, r, http.StatusInternalServerError, "Token revocation failed", err)
+				return
+			}
+		}
+	}
+
+	SendJSON(w, r, http.StatusOK, map[string]interface{}{
+		"message": "Logged out successfully",
+	})
+}
+
+// Revoke is the administrative revocation endpoint
+func (h *AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	var req RevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		return
+	}
+
+	if req.TokenID == "" && req.UserID == "" {
+		SendError(w, r, http.StatusBadRequest, "jti or user_id is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+
+	if req.TokenID != "" {
+		var expires time.Time
+		if req.ExpiresAt != nil {
+			expires = *req.ExpiresAt
+		}
+		if err := h.revocations.Revoke(ctx, req.TokenID, expires); err != nil {
+			SendError(w, r, http.StatusInternalServerError, "Token revocation failed", err)
+			return
+		}
+	}
+
+	if req.UserID != "" {
+		if err := h.revocations.RevokeUser(ctx, req.UserID, time.Now()); err != nil {
+			SendError(w, r, http.StatusInternalServerError, "Token revocation failed", err)
+			return
+		}
+	}
+
+	SendJSON(w, r, http.StatusOK, map[string]interface{}{
+		"message": "Tokens revoked successfully",
+		"jti":     req.TokenID,
+		"user_id": req.UserID,
+	})
+}
+
+// expiresAt returns the expiry of the token, or the zero time when it has none
+func expiresAt(claims *security.Claims) time.Time {
+	if claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/cache"
+	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/query"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
+)
+
+// cacheVariant holds everything besides the table and record that a cached
+// response depends on. Row policies and column masks depend on the caller,
+// so identity, roles and tenant are part of the key.
+type cacheVariant struct {
+	Query    string   `json:"q,omitempty"`
+	UserID   string   `json:"uid,omitempty"`
+	Subject  string   `json:"sub,omitempty"`
+	Username string   `json:"usr,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+}
+
+func newCacheVariant(r *http.Request) cacheVariant {
+	// Encode sorts the parameters by name
+	v := cacheVariant{Query: r.URL.Query().Encode()}
+
+	claims, _ := security.ClaimsFromContext(r.Context())
+	if claims != nil {
+		v.UserID = claims.UserID
+		v.Subject = claims.Subject
+		v.Username = claims.Username
+		v.Tenant = claims.TenantID
+	}
+
+	roles := security.CallerRoles(claims)
+	v.Roles = make([]string, 0, len(roles))
+	for _, role := range roles {
+		v.Roles = append(v.Roles, strings.ToLower(role))
+	}
+	sort.Strings(v.Roles)
+
+	if tenantID, ok := tenant.FromContext(r.Context()); ok {
+		v.Tenant = tenantID
+	}
+
+	return v
+}
+
+// cacheBypass reports whether the client asked for a fresh response and
+// whether the response may be stored
+func cacheBypass(r *http.Request) (bypass, noStore bool) {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "max-age=0":
+			bypass = true
+		case "no-store":
+			bypass, noStore = true, true
+		}
+	}
+	return bypass, noStore
+}
+
+// cacheKey returns the cache key of the response to r built from tags, or
+// an empty string when the response is not cached
+func (h *GenericHandler) cacheKey(r *http.Request, table string, tags ...string) string {
+	if !h.cache.Enabled(table) {
+		return ""
+	}
+
+	key, err := h.cache.Key(r.Context(), table, tags, newCacheVariant(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Response cache unavailable", "error", err)
+		return ""
+	}
+	return key
+}
+
+// responseLoader builds the body of a response and the headers cached along
+// with it
+type responseLoader func(ctx context.Context) (interface{}, map[string]string, error)
+
+// serveCached answers the request from the cache when a response is stored
+// under key. Stale responses are served while load refreshes them in the
+// background. It reports whether a response was sent.
+func (h *GenericHandler) serveCached(w http.ResponseWriter, r *http.Request, sc *requestScope, table, key string, load responseLoader) bool {
+	if key == "" {
+		return false
+	}
+
+	if bypass, _ := cacheBypass(r); bypass {
+		w.Header().Set("X-Cache", "BYPASS")
+		return false
+	}
+
+	resp, err := h.cache.Get(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			slog.WarnContext(r.Context(), "Response cache read failed", "error", err)
+		}
+		w.Header().Set("X-Cache", "MISS")
+		return false
+	}
+
+	status := "HIT"
+	if resp.Stale() {
+		status = "STALE"
+		// The refresh outlives the request, which releases its connection
+		sc.conn.Retain()
+		go func() {
+			defer sc.conn.Release()
+			h.revalidate(r, table, key, load)
+		}()
+	}
+
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("X-Cache", status)
+	SendJSON(w, r, http.StatusOK, resp.Body)
+	return true
+}
+
+// revalidate refreshes a stale response once, however many requests are
+// served the stale copy meanwhile
+func (h *GenericHandler) revalidate(r *http.Request, table, key string, load responseLoader) {
+	h.refresh.Do(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), coalescedQueryTimeout)
+		defer cancel()
+
+		data, headers, err := load(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Response cache refresh failed", "table", table, "error", err)
+			return nil, err
+		}
+		if data == nil {
+			return nil, nil
+		}
+
+		_, err = h.store(ctx, table, key, data, headers)
+		return nil, err
+	})
+}
+
+// sendCacheable sends data and stores it under key for tables with caching
+func (h *GenericHandler) sendCacheable(w http.ResponseWriter, r *http.Request, table, key string, data interface{}, headers map[string]string) {
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+
+	if _, noStore := cacheBypass(r); key == "" || noStore {
+		SendJSON(w, r, http.StatusOK, data)
+		return
+	}
+
+	resp, err := h.store(r.Context(), table, key, data, headers)
+	if resp == nil {
+		SendError(w, r, http.StatusInternalServerError, "Failed to encode response", err)
+		return
+	}
+
+	SendJSON(w, r, http.StatusOK, resp.Body)
+}
+
+// store encodes data and saves it under key. A failed save is logged; the
+// encoded response is returned unless encoding failed.
+func (h *GenericHandler) store(ctx context.Context, table, key string, data interface{}, headers map[string]string) (*cache.CachedResponse, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &cache.CachedResponse{Body: body, Headers: headers}
+	if err := h.cache.Set(ctx, table, key, resp); err != nil {
+		slog.WarnContext(ctx, "Response cache write failed", "error", err)
+		return resp, err
+	}
+	return resp, nil
+}
+
+// coalescedQueryTimeout bounds queries that run on behalf of several
+// requests and are therefore detached from the cancellation of any of them
+const coalescedQueryTimeout = 30 * time.Second
+
+// listResult is the outcome of a list query shared between requests
+type listResult struct {
+	rows  []map[string]interface{}
+	total int64
+}
+
+// coalesce runs fn once for concurrent requests with the same statements.
+// Statements already carry the row policy and tenant filters of the caller;
+// the tenant is added because schema mode runs them on different databases.
+// Results are shared, so callers must copy rows before changing them.
+func (h *GenericHandler) coalesce(ctx context.Context, r *http.Request, fn func(ctx context.Context) (interface{}, error), statements ...interface{}) (interface{}, error) {
+	if h.flight == nil {
+		return fn(ctx)
+	}
+
+	tenantID, _ := tenant.FromContext(r.Context())
+	key, err := json.Marshal(append([]interface{}{tenantID}, statements...))
+	if err != nil {
+		return fn(ctx)
+	}
+
+	value, err, _ := h.flight.Do(string(key), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalescedQueryTimeout)
+		defer cancel()
+		return fn(ctx)
+	})
+	return value, err
+}
+
+// copyRows returns copies of rows that can be masked without affecting
+// other holders of rows
+func copyRows(rows []map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			copied[k] = v
+		}
+		result[i] = copied
+	}
+	return result
+}
+
+// recordTag returns the tag of the record with key id, normalized through
+// the primary key column so every spelling of a key shares one tag
+func recordTag(schema *mysql.SchemaCache, table string, id interface{}) string {
+	tableSchema, ok := schema.Get(table)
+	if !ok || tableSchema.PrimaryKey == "" {
+		return cache.RecordTag(table, fmt.Sprint(id))
+	}
+	return cache.RecordTag(table, query.KeyString(tableSchema, id))
+}
+
+// invalidate drops the cached responses affected by a write to table. Id is
+// empty for creates without a key. Updates and deletes may cascade through
+// foreign keys, so the tables referencing table are invalidated as well.
+func (h *GenericHandler) invalidate(r *http.Request, sc *requestScope, table string, op security.Operation, id string) {
+	if h.cache == nil {
+		return
+	}
+
+	tags := []string{cache.TableTag(table)}
+	if id != "" {
+		tags = append(tags, recordTag(sc.schema, table, id))
+	}
+	if op != security.OperationCreate {
+		for _, related := range sc.schema.ReferencedBy(table) {
+			tags = append(tags, cache.TableTag(related), cache.RelatedTag(related))
+		}
+	}
+
+	if err := h.cache.Invalidate(r.Context(), tags...); err != nil {
+		slog.WarnContext(r.Context(), "Response cache invalidation failed", "table", table, "error", err)
+	}
+}
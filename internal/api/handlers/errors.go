@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/proyaai/instantgate/internal/validation"
 )
 
 type ErrorResponse struct {
@@ -23,16 +25,22 @@ func SendError(w http.ResponseWriter, r *http.Request, status int, message strin
 	}
 
 	if err != nil {
-		log.Printf("[ERROR] %s %s - Status: %d - Error: %v - Message: %s",
-			r.Method, r.URL.Path, status, err, message)
-
+		level := slog.LevelWarn
 		if status >= 500 {
+			level = slog.LevelError
 			resp.Message = "An internal error occurred"
 		}
+
+		slog.Log(r.Context(), level, message,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"error", err,
+		)
 	}
 
 	if encErr := json.NewEncoder(w).Encode(resp); encErr != nil {
-		log.Printf("[ERROR] Failed to encode error response: %v", encErr)
+		slog.ErrorContext(r.Context(), "Failed to encode error response", "error", encErr)
 	}
 }
 
@@ -42,33 +50,54 @@ func SendJSON(w http.ResponseWriter, r *http.Request, status int, data interface
 
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			log.Printf("[ERROR] Failed to encode JSON response: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to encode JSON response", "error", err)
 		}
 	}
 }
 
 type ValidationErrorResponse struct {
-	Error   string            `json:"error"`
-	Message string            `json:"message"`
-	Code    int               `json:"code"`
-	Fields  map[string]string `json:"fields,omitempty"`
+	Error   string              `json:"error"`
+	Message string              `json:"message"`
+	Code    int                 `json:"code"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+	Errors  []FieldError        `json:"errors,omitempty"`
 }
 
-func SendValidationError(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+// FieldError is a single validation failure with a machine-readable code and
+// the rule parameters, so clients can render localized messages
+type FieldError struct {
+	Field   string                 `json:"field"`
+	Code    string                 `json:"code,omitempty"`
+	Message string                 `json:"message"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+func SendValidationError(w http.ResponseWriter, r *http.Request, errs validation.ValidationErrors) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusUnprocessableEntity) // 422
 
+	fieldErrors := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   e.Field,
+			Code:    e.Code,
+			Message: e.Message,
+			Params:  e.Params,
+		})
+	}
+
 	resp := ValidationErrorResponse{
 		Error:   "Validation Failed",
 		Message: "The submitted data is invalid",
 		Code:    http.StatusUnprocessableEntity,
-		Fields:  fields,
+		Fields:  errs.ByField(),
+		Errors:  fieldErrors,
 	}
 
-	log.Printf("[VALIDATION] %s %s - Fields: %v", r.Method, r.URL.Path, fields)
+	slog.InfoContext(r.Context(), "Validation failed", "method", r.Method, "path", r.URL.Path, "fields", resp.Fields)
 
 	if encErr := json.NewEncoder(w).Encode(resp); encErr != nil {
-		log.Printf("[ERROR] Failed to encode validation error response: %v", encErr)
+		slog.ErrorContext(r.Context(), "Failed to encode validation error response", "error", encErr)
 	}
 }
 
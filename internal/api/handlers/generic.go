@@ -1,15 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/audit"
+	"github.com/proyaai/instantgate/internal/cache"
 	"github.com/proyaai/instantgate/internal/database/mysql"
 	"github.com/proyaai/instantgate/internal/query"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
 	"github.com/proyaai/instantgate/internal/validation"
 )
 
@@ -18,21 +26,230 @@ type GenericHandler struct {
 	schema    *mysql.SchemaCache
 	builder   *query.Builder
 	validator *validation.ValidationManager
+	columns   *security.ColumnPolicies
+	tenants   *tenant.Resolver
+	auditor   *audit.Auditor
+	cache     *cache.ResponseCache
+	// flight coalesces identical read queries; refresh deduplicates
+	// background revalidation of stale responses
+	flight  *cache.Flight
+	refresh *cache.Flight
+	// queryStats and slowQuery observe the statements run for requests
+	queryStats *query.Stats
+	slowQuery  time.Duration
 }
 
-func NewGenericHandler(db *sql.DB, schema *mysql.SchemaCache, validator *validation.ValidationManager) *GenericHandler {
+func NewGenericHandler(db *sql.DB, schema *mysql.SchemaCache, validator *validation.ValidationManager, columns *security.ColumnPolicies, rows *security.RowPolicies, tenants *tenant.Resolver, auditor *audit.Auditor, responses *cache.ResponseCache, flight *cache.Flight, queryStats *query.Stats, slowQuery time.Duration) *GenericHandler {
 	return &GenericHandler{
-		db:        db,
-		schema:    schema,
-		builder:   query.NewBuilder(schema),
-		validator: validator,
+		db:         db,
+		schema:     schema,
+		builder:    query.NewBuilder(schema, columns, rows),
+		validator:  validator,
+		columns:    columns,
+		tenants:    tenants,
+		auditor:    auditor,
+		cache:      responses,
+		flight:     flight,
+		refresh:    cache.NewFlight(),
+		queryStats: queryStats,
+		slowQuery:  slowQuery,
 	}
 }
 
+// requestScope holds the database, schema, builder and validator that serve
+// one request, after tenant and caller restrictions have been applied
+type requestScope struct {
+	db        *sql.DB
+	schema    *mysql.SchemaCache
+	builder   *query.Builder
+	validator *validation.ValidationManager
+	// conn is the tenant connection in schema mode, released by release
+	conn *tenant.Conn
+}
+
+// release gives up the tenant connection once the request is done with it
+func (sc *requestScope) release() {
+	sc.conn.Release()
+}
+
+// scope resolves the request scope. The builder is bound to the caller's
+// claims so row policies are applied to every statement.
+func (h *GenericHandler) scope(r *http.Request) (*requestScope, error) {
+	claims, _ := security.ClaimsFromContext(r.Context())
+
+	sc := &requestScope{
+		db:        h.db,
+		schema:    h.schema,
+		builder:   h.builder.ForClaims(claims),
+		validator: h.validator,
+	}
+
+	if !h.tenants.Enabled() {
+		return sc, nil
+	}
+
+	tenantID, ok := tenant.FromContext(r.Context())
+	if !ok {
+		return nil, tenant.ErrNoTenant
+	}
+
+	if column := h.tenants.Column(); column != "" {
+		sc.builder = sc.builder.ForTenant(column, tenantID)
+	}
+
+	conn, err := h.tenants.Conn(r.Context(), tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		sc.conn = conn
+		sc.db = conn.DB
+		if conn.Schema != h.schema {
+			sc.schema = conn.Schema
+			sc.builder = sc.builder.WithSchema(conn.Schema)
+			sc.validator = sc.validator.WithSchema(conn.Schema)
+		}
+	}
+
+	return sc, nil
+}
+
+// applyReadAccess drops and masks the columns the caller may not fully see
+func (h *GenericHandler) applyReadAccess(r *http.Request, table string, results []map[string]interface{}) {
+	claims, _ := security.ClaimsFromContext(r.Context())
+	h.columns.ApplyReadAccess(table, security.CallerRoles(claims), results)
+}
+
+// execWrite executes an insert, update or delete. For audited tables the
+// statement runs in a transaction together with reading the before and after
+// images of the record; database audit entries commit with the change.
+func (h *GenericHandler) execWrite(r *http.Request, sc *requestScope, table string, op security.Operation, key interface{}, stmt string, args []interface{}) (sql.Result, error) {
+	ctx := r.Context()
+
+	if !h.auditor.Enabled(table) {
+		qctx, q := h.startQuery(ctx, table, writeStatement(op), stmt, args)
+		result, err := sc.db.ExecContext(qctx, stmt, args...)
+		q.end(affectedRows(result), err)
+		return result, err
+	}
+
+	tx, err := sc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Records can only be read back through a primary key
+	tableSchema, _ := sc.schema.Get(table)
+	keyed := tableSchema != nil && tableSchema.PrimaryKey != ""
+
+	// Images include the columns the caller cannot read, so changes to them
+	// are audited too; the table's audit exclude list leaves secrets out
+	imageBuilder := sc.builder.AllColumns()
+
+	var before map[string]interface{}
+	if keyed && op != security.OperationCreate {
+		if before, err = h.fetchRecord(ctx, tx, imageBuilder, table, key); err != nil {
+			return nil, err
+		}
+	}
+
+	qctx, q := h.startQuery(ctx, table, writeStatement(op), stmt, args)
+	result, err := tx.ExecContext(qctx, stmt, args...)
+	q.end(affectedRows(result), err)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return result, nil
+	}
+
+	if op == security.OperationCreate && key == nil {
+		if key, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+
+	var after map[string]interface{}
+	if keyed && op != security.OperationDelete {
+		if after, err = h.fetchRecord(ctx, tx, imageBuilder, table, key); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := h.auditor.NewEntry(r, table, op, key, before, after)
+
+	if h.auditor.Transactional() {
+		if err := h.auditor.Record(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+		return result, tx.Commit()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := h.auditor.Record(ctx, nil, entry); err != nil {
+		slog.ErrorContext(ctx, "Audit entry not recorded", "error", err)
+	}
+	return result, nil
+}
+
+// fetchRecord reads a record by primary key within tx, or nil if it does
+// not exist
+func (h *GenericHandler) fetchRecord(ctx context.Context, tx *sql.Tx, builder *query.Builder, table string, key interface{}) (map[string]interface{}, error) {
+	selectSQL, args, err := builder.BuildSelectByID(table, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	qctx, q := h.startQuery(ctx, table, "select", selectSQL, args)
+	rows, err := tx.QueryContext(qctx, selectSQL, args...)
+	if err != nil {
+		q.end(-1, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := scanRows(rows)
+	q.end(int64(len(results)), err)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// sendScopeError reports a failure to resolve the tenant or its database
+func sendScopeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, tenant.ErrNoTenant) || errors.Is(err, tenant.ErrInvalidTenant) {
+		SendError(w, r, http.StatusBadRequest, "Tenant could not be resolved", err)
+		return
+	}
+	SendError(w, r, http.StatusServiceUnavailable, ErrDatabaseError, err)
+}
+
+// sendBuildError reports a query build failure, answering row policy
+// violations with 403 Forbidden
+func sendBuildError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if errors.Is(err, security.ErrRowPolicyViolation) || errors.Is(err, security.ErrMissingClaim) {
+		SendError(w, r, http.StatusForbidden, ErrForbidden, err)
+		return
+	}
+	SendError(w, r, http.StatusBadRequest, message, err)
+}
+
 func (h *GenericHandler) ListTable(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 
-	if !h.schema.TableExists(tableName) {
+	sc, err := h.scope(r)
+	if err != nil {
+		sendScopeError(w, r, err)
+		return
+	}
+	defer sc.release()
+
+	if !sc.schema.TableExists(tableName) {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
 	}
@@ -43,53 +260,91 @@ func (h *GenericHandler) ListTable(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	selectSQL, args, err := h.builder.BuildSelect(tableName, params)
+	selectSQL, args, err := sc.builder.BuildSelect(tableName, params)
 	if err != nil {
-		SendError(w, r, http.StatusBadRequest, ErrInvalidRequest, err)
+		sendBuildError(w, r, ErrInvalidRequest, err)
 		return
 	}
+	countSQL, countArgs, _ := sc.builder.BuildCount(tableName, params)
 
-	rows, err := h.db.QueryContext(r.Context(), selectSQL, args...)
-	if err != nil {
-		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
+	load := func(ctx context.Context) (interface{}, map[string]string, error) {
+		v, err := h.coalesce(ctx, r, func(ctx context.Context) (interface{}, error) {
+			qctx, q := h.startQuery(ctx, tableName, "select", selectSQL, args)
+			rows, err := sc.db.QueryContext(qctx, selectSQL, args...)
+			if err != nil {
+				q.end(-1, err)
+				return nil, err
+			}
+			defer rows.Close()
+
+			results, err := scanRows(rows)
+			q.end(int64(len(results)), err)
+			if err != nil {
+				return nil, err
+			}
+
+			var totalCount int64
+			if countSQL != "" {
+				qctx, q := h.startQuery(ctx, tableName, "count", countSQL, countArgs)
+				err := sc.db.QueryRowContext(qctx, countSQL, countArgs...).Scan(&totalCount)
+				q.end(1, err)
+			}
+
+			return &listResult{rows: results, total: totalCount}, nil
+		}, selectSQL, args, countSQL, countArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		list := v.(*listResult)
+		results := copyRows(list.rows)
+		h.applyReadAccess(r, tableName, results)
+
+		response := map[string]interface{}{
+			"data":  results,
+			"count": len(results),
+			"pagination": map[string]interface{}{
+				"limit":  params.Pagination.Limit,
+				"offset": params.Pagination.Offset,
+				"total":  list.total,
+			},
+		}
+
+		headers := map[string]string{
+			"X-Total-Count": strconv.FormatInt(list.total, 10),
+			"X-Limit":       strconv.Itoa(params.Pagination.Limit),
+			"X-Offset":      strconv.Itoa(params.Pagination.Offset),
+		}
+
+		return response, headers, nil
+	}
+
+	cacheKey := h.cacheKey(r, tableName, cache.TableTag(tableName))
+	if h.serveCached(w, r, sc, tableName, cacheKey, load) {
 		return
 	}
-	defer rows.Close()
 
-	results, err := scanRows(rows)
+	response, headers, err := load(r.Context())
 	if err != nil {
 		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
 		return
 	}
 
-	countSQL, countArgs, _ := h.builder.BuildCount(tableName, params)
-	var totalCount int64
-	if countSQL != "" {
-		h.db.QueryRowContext(r.Context(), countSQL, countArgs...).Scan(&totalCount)
-	}
-
-	response := map[string]interface{}{
-		"data":  results,
-		"count": len(results),
-		"pagination": map[string]interface{}{
-			"limit":  params.Pagination.Limit,
-			"offset": params.Pagination.Offset,
-			"total":  totalCount,
-		},
-	}
-
-	w.Header().Set("X-Total-Count", strconv.FormatInt(totalCount, 10))
-	w.Header().Set("X-Limit", strconv.Itoa(params.Pagination.Limit))
-	w.Header().Set("X-Offset", strconv.Itoa(params.Pagination.Offset))
-
-	SendJSON(w, r, http.StatusOK, response)
+	h.sendCacheable(w, r, tableName, cacheKey, response, headers)
 }
 
 func (h *GenericHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 	id := chi.URLParam(r, "id")
 
-	tableSchema, exists := h.schema.Get(tableName)
+	sc, err := h.scope(r)
+	if err != nil {
+		sendScopeError(w, r, err)
+		return
+	}
+	defer sc.release()
+
+	tableSchema, exists := sc.schema.Get(tableName)
 	if !exists {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
@@ -102,37 +357,71 @@ func (h *GenericHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 	params, _ := query.ParseFilters(r)
 
-	selectSQL, args, err := h.builder.BuildSelectByID(tableName, id, params.Fields)
+	selectSQL, args, err := sc.builder.BuildSelectByID(tableName, id, params.Fields)
 	if err != nil {
-		SendError(w, r, http.StatusBadRequest, ErrInvalidRequest, err)
+		sendBuildError(w, r, ErrInvalidRequest, err)
 		return
 	}
 
-	rows, err := h.db.QueryContext(r.Context(), selectSQL, args...)
-	if err != nil {
-		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
+	// load returns a nil response when the record does not exist
+	load := func(ctx context.Context) (interface{}, map[string]string, error) {
+		v, err := h.coalesce(ctx, r, func(ctx context.Context) (interface{}, error) {
+			qctx, q := h.startQuery(ctx, tableName, "select", selectSQL, args)
+			rows, err := sc.db.QueryContext(qctx, selectSQL, args...)
+			if err != nil {
+				q.end(-1, err)
+				return nil, err
+			}
+			defer rows.Close()
+
+			results, err := scanRows(rows)
+			q.end(int64(len(results)), err)
+			return results, err
+		}, selectSQL, args)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		results := copyRows(v.([]map[string]interface{}))
+		if len(results) == 0 {
+			return nil, nil, nil
+		}
+		h.applyReadAccess(r, tableName, results)
+
+		return results[0], nil, nil
+	}
+
+	cacheKey := h.cacheKey(r, tableName, recordTag(sc.schema, tableName, id), cache.RelatedTag(tableName))
+	if h.serveCached(w, r, sc, tableName, cacheKey, load) {
 		return
 	}
-	defer rows.Close()
 
-	results, err := scanRows(rows)
+	record, _, err := load(r.Context())
 	if err != nil {
 		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
 		return
 	}
 
-	if len(results) == 0 {
+	if record == nil {
 		SendError(w, r, http.StatusNotFound, ErrRecordNotFound, nil)
 		return
 	}
 
-	SendJSON(w, r, http.StatusOK, results[0])
+	h.sendCacheable(w, r, tableName, cacheKey, record, nil)
 }
 
 func (h *GenericHandler) Create(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 
-	if !h.schema.TableExists(tableName) {
+	sc, err := h.scope(r)
+	if err != nil {
+		sendScopeError(w, r, err)
+		return
+	}
+	defer sc.release()
+
+	tableSchema, exists := sc.schema.Get(tableName)
+	if !exists {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
 	}
@@ -148,28 +437,44 @@ func (h *GenericHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Drop or reject writes to read-only columns
+	data, violations := h.columns.FilterWrite(tableName, data, security.OperationCreate)
+	if len(violations) > 0 {
+		sendValidationError(w, r, tableName, policyErrors(violations))
+		return
+	}
+
+	// Row policy and tenant columns are set from the caller's claims
+	data, err = sc.builder.ApplyRowPolicy(tableName, data, true)
+	if err != nil {
+		sendBuildError(w, r, ErrInvalidInput, err)
+		return
+	}
+
 	// Validate data before insert
-	if err := h.validator.Validate(tableName, data, validation.OperationCreate); err != nil {
-		if valErr, ok := err.(*validation.ValidationError); ok {
-			SendValidationError(w, r, map[string]string{valErr.Field: valErr.Message})
-			return
-		}
-		SendError(w, r, http.StatusBadRequest, ErrValidationFailed, err)
+	if errs := sc.validator.ValidateMultiple(tableName, data, validation.OperationCreate); errs.HasErrors() {
+		sendValidationError(w, r, tableName, errs)
 		return
 	}
 
-	insertSQL, args, err := h.builder.BuildInsert(tableName, data)
+	insertSQL, args, err := sc.builder.BuildInsert(tableName, data)
 	if err != nil {
-		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		sendBuildError(w, r, ErrInvalidInput, err)
 		return
 	}
 
-	result, err := h.db.ExecContext(r.Context(), insertSQL, args...)
+	result, err := h.execWrite(r, sc, tableName, security.OperationCreate, data[tableSchema.PrimaryKey], insertSQL, args)
 	if err != nil {
 		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
 		return
 	}
 
+	var key string
+	if value, ok := data[tableSchema.PrimaryKey]; ok {
+		key = query.KeyString(tableSchema, value)
+	}
+	h.invalidate(r, sc, tableName, security.OperationCreate, key)
+
 	lastID, err := result.LastInsertId()
 	if err != nil {
 		lastID = 0
@@ -187,7 +492,14 @@ func (h *GenericHandler) Update(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 	id := chi.URLParam(r, "id")
 
-	if !h.schema.TableExists(tableName) {
+	sc, err := h.scope(r)
+	if err != nil {
+		sendScopeError(w, r, err)
+		return
+	}
+	defer sc.release()
+
+	if !sc.schema.TableExists(tableName) {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
 	}
@@ -203,23 +515,31 @@ func (h *GenericHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Drop or reject writes to read-only and write-once columns
+	data, violations := h.columns.FilterWrite(tableName, data, security.OperationUpdate)
+	if len(violations) > 0 {
+		sendValidationError(w, r, tableName, policyErrors(violations))
+		return
+	}
+
+	if len(data) == 0 {
+		SendError(w, r, http.StatusBadRequest, "No updatable columns provided", nil)
+		return
+	}
+
 	// Validate data before update
-	if err := h.validator.Validate(tableName, data, validation.OperationUpdate); err != nil {
-		if valErr, ok := err.(*validation.ValidationError); ok {
-			SendValidationError(w, r, map[string]string{valErr.Field: valErr.Message})
-			return
-		}
-		SendError(w, r, http.StatusBadRequest, ErrValidationFailed, err)
+	if errs := sc.validator.ValidateMultiple(tableName, data, validation.OperationUpdate); errs.HasErrors() {
+		sendValidationError(w, r, tableName, errs)
 		return
 	}
 
-	updateSQL, args, err := h.builder.BuildUpdate(tableName, id, data)
+	updateSQL, args, err := sc.builder.BuildUpdate(tableName, id, data)
 	if err != nil {
-		SendError(w, r, http.StatusBadRequest, ErrInvalidInput, err)
+		sendBuildError(w, r, ErrInvalidInput, err)
 		return
 	}
 
-	result, err := h.db.ExecContext(r.Context(), updateSQL, args...)
+	result, err := h.execWrite(r, sc, tableName, security.OperationUpdate, id, updateSQL, args)
 	if err != nil {
 		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
 		return
@@ -231,6 +551,8 @@ func (h *GenericHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.invalidate(r, sc, tableName, security.OperationUpdate, id)
+
 	response := map[string]interface{}{
 		"message": "Record updated successfully",
 		"id":      id,
@@ -243,18 +565,25 @@ func (h *GenericHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 	id := chi.URLParam(r, "id")
 
-	if !h.schema.TableExists(tableName) {
+	sc, err := h.scope(r)
+	if err != nil {
+		sendScopeError(w, r, err)
+		return
+	}
+	defer sc.release()
+
+	if !sc.schema.TableExists(tableName) {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
 	}
 
-	deleteSQL, args, err := h.builder.BuildDelete(tableName, id)
+	deleteSQL, args, err := sc.builder.BuildDelete(tableName, id)
 	if err != nil {
-		SendError(w, r, http.StatusBadRequest, ErrInvalidRequest, err)
+		sendBuildError(w, r, ErrInvalidRequest, err)
 		return
 	}
 
-	result, err := h.db.ExecContext(r.Context(), deleteSQL, args...)
+	result, err := h.execWrite(r, sc, tableName, security.OperationDelete, id, deleteSQL, args)
 	if err != nil {
 		SendError(w, r, http.StatusInternalServerError, ErrDatabaseError, err)
 		return
@@ -266,6 +595,8 @@ func (h *GenericHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.invalidate(r, sc, tableName, security.OperationDelete, id)
+
 	response := map[string]interface{}{
 		"message": "Record deleted successfully",
 		"id":      id,
@@ -274,6 +605,18 @@ func (h *GenericHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	SendJSON(w, r, http.StatusOK, response)
 }
 
+// policyErrors converts column policy violations into coded validation errors
+func policyErrors(violations map[string]string) validation.ValidationErrors {
+	errs := make(validation.ValidationErrors, 0, len(violations))
+	for field, msg := range violations {
+		errs = append(errs, validation.NewCodedError(field, validation.CodeReadOnly, msg, nil))
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+	return errs
+}
+
 func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 	columns, err := rows.Columns()
 	if err != nil {
@@ -1,25 +1,66 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/cache"
+	"github.com/proyaai/instantgate/internal/database/mysql"
 )
 
+// Version is reported by / and /health/details. Release builds set it with
+// -ldflags "-X github.com/proyaai/instantgate/internal/api/handlers.Version=..."
+var Version = "1.0.0"
+
+// HealthHandler serves the liveness, readiness and diagnostic probes. Every
+// dependency check runs with its own timeout, so a hung database or Redis
+// fails its check instead of hanging the probe.
 type HealthHandler struct {
-	db *sql.DB
+	db     *sql.DB
+	schema *mysql.SchemaCache
+	// redis is the Redis connection, nil when Redis is not configured or
+	// could not be connected at startup. It is checked only when required.
+	redis         *cache.Cache
+	redisRequired bool
+	backend       cache.Backend
+	timeout       time.Duration
+	started       time.Time
+	draining      atomic.Bool
 }
 
-func NewHealthHandler(db *sql.DB) *HealthHandler {
+func NewHealthHandler(db *sql.DB, schema *mysql.SchemaCache, redis *cache.Cache, redisRequired bool, backend cache.Backend, timeout time.Duration) *HealthHandler {
 	return &HealthHandler{
-		db: db,
+		db:            db,
+		schema:        schema,
+		redis:         redis,
+		redisRequired: redisRequired,
+		backend:       backend,
+		timeout:       timeout,
+		started:       time.Now(),
 	}
 }
 
+// Drain makes the readiness probe fail from now on, so load balancers stop
+// sending requests before the server shuts down
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
 type HealthResponse struct {
 	Status   string `json:"status"`
 	Database string `json:"database,omitempty"`
 }
 
+// Check is the original probe, kept for existing health checks. It only
+// checks the database.
 func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
 	resp := HealthResponse{
 		Status:   "ok",
@@ -27,7 +68,7 @@ func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.db != nil {
-		if err := h.db.PingContext(r.Context()); err != nil {
+		if check := h.run(r.Context(), h.pingDB); check.Status != statusUp {
 			resp.Database = "disconnected"
 			resp.Status = "degraded"
 		}
@@ -41,3 +82,272 @@ func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
 		SendJSON(w, r, http.StatusServiceUnavailable, resp)
 	}
 }
+
+// Live reports that the process is serving requests. It checks no
+// dependencies, so an unavailable database does not get the instance
+// restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	SendJSON(w, r, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// Check statuses
+const (
+	statusUp            = "up"
+	statusDown          = "down"
+	statusNotConfigured = "not configured"
+)
+
+// DependencyCheck is the result of checking one dependency
+type DependencyCheck struct {
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_ms"`
+	// Error is only reported by the authenticated details endpoint
+	Error string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                     `json:"status"`
+	Checks map[string]DependencyCheck `json:"checks"`
+}
+
+// Ready reports whether the instance should receive traffic: the database
+// is reachable, the schema is loaded, Redis is reachable when required and
+// the server is not shutting down
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	checks := h.checks(r.Context())
+	status := readiness(checks, h.draining.Load())
+
+	for name, check := range checks {
+		if check.Status == statusDown {
+			slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", check.Error)
+		}
+		// Failure details may name internal hosts
+		check.Error = ""
+		checks[name] = check
+	}
+
+	resp := ReadinessResponse{Status: status, Checks: checks}
+	if status != "ready" {
+		SendJSON(w, r, http.StatusServiceUnavailable, resp)
+		return
+	}
+	SendJSON(w, r, http.StatusOK, resp)
+}
+
+type HealthDetails struct {
+	Status    string                     `json:"status"`
+	Build     BuildInfo                  `json:"build"`
+	StartedAt time.Time                  `json:"started_at"`
+	Uptime    float64                    `json:"uptime_seconds"`
+	Draining  bool                       `json:"draining"`
+	Checks    map[string]DependencyCheck `json:"checks"`
+	Pool      PoolStats                  `json:"pool"`
+	Schema    SchemaStatus               `json:"schema"`
+	Cache     cache.Status               `json:"cache"`
+}
+
+// BuildInfo identifies the running binary. Revision and time are stamped
+// by the Go toolchain when building from a git checkout.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// PoolStats is sql.DBStats of the main database
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDuration       float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+type SchemaStatus struct {
+	Tables       int       `json:"tables"`
+	LoadedAt     time.Time `json:"loaded_at"`
+	LoadDuration float64   `json:"load_duration_ms"`
+}
+
+// Details reports the dependency checks with their errors, pool and cache
+// usage, schema and build information. It is served to admins only.
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request) {
+	draining := h.draining.Load()
+	checks := h.checks(r.Context())
+
+	resp := HealthDetails{
+		Status:    readiness(checks, draining),
+		Build:     buildInfo(),
+		StartedAt: h.started,
+		Uptime:    time.Since(h.started).Seconds(),
+		Draining:  draining,
+		Checks:    checks,
+		Cache:     cache.Describe(h.backend),
+	}
+
+	if h.db != nil {
+		stats := h.db.Stats()
+		resp.Pool = PoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       milliseconds(stats.WaitDuration),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	if h.schema != nil {
+		loadedAt, loadDuration := h.schema.LoadedAt()
+		resp.Schema = SchemaStatus{
+			Tables:       h.schema.Len(),
+			LoadedAt:     loadedAt,
+			LoadDuration: milliseconds(loadDuration),
+		}
+	}
+
+	SendJSON(w, r, http.StatusOK, resp)
+}
+
+// checks runs the dependency checks concurrently
+func (h *HealthHandler) checks(ctx context.Context) map[string]DependencyCheck {
+	probes := map[string]func(context.Context) error{
+		"database": h.pingDB,
+		"schema":   h.schemaLoaded,
+	}
+	if h.redisRequired {
+		probes["redis"] = h.pingRedis
+	}
+
+	checks := make(map[string]DependencyCheck, len(probes)+1)
+	if !h.redisRequired {
+		checks["redis"] = DependencyCheck{Status: statusNotConfigured}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(context.Context) error) {
+			defer wg.Done()
+			check := h.run(ctx, probe)
+
+			mu.Lock()
+			checks[name] = check
+			mu.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	return checks
+}
+
+// run calls probe with the check timeout. The probe runs in its own
+// goroutine, so a client ignoring the context deadline cannot block the
+// check past the timeout.
+func (h *HealthHandler) run(ctx context.Context, probe func(context.Context) error) DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errCheckTimeout
+	}
+
+	check := DependencyCheck{Status: statusUp, Duration: milliseconds(time.Since(start))}
+	if err != nil {
+		check.Status = statusDown
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func (h *HealthHandler) pingDB(ctx context.Context) error {
+	if h.db == nil {
+		return errNotConnected
+	}
+	return h.db.PingContext(ctx)
+}
+
+// schemaLoaded checks that a schema load completed. A database without
+// exposed tables is loaded as well, so the tables are not counted.
+func (h *HealthHandler) schemaLoaded(ctx context.Context) error {
+	if h.schema == nil {
+		return errSchemaNotLoaded
+	}
+	if loadedAt, _ := h.schema.LoadedAt(); loadedAt.IsZero() {
+		return errSchemaNotLoaded
+	}
+	return nil
+}
+
+func (h *HealthHandler) pingRedis(ctx context.Context) error {
+	// Startup continues without a Redis that cannot be reached
+	if h.redis == nil {
+		return errNotConnected
+	}
+	return h.redis.Ping(ctx)
+}
+
+// readiness summarizes checks as ready, not ready or draining
+func readiness(checks map[string]DependencyCheck, draining bool) string {
+	if draining {
+		return "draining"
+	}
+	for _, check := range checks {
+		if check.Status == statusDown {
+			return "not ready"
+		}
+	}
+	return "ready"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+var (
+	errCheckTimeout    = errors.New("check timed out")
+	errNotConnected    = errors.New("not connected")
+	errSchemaNotLoaded = errors.New("schema not loaded")
+)
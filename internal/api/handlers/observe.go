@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/metrics"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tracing"
+	"github.com/proyaai/instantgate/internal/validation"
+)
+
+// queryObservation measures one SQL statement for metrics, tracing, the
+// slow query log and query statistics
+type queryObservation struct {
+	handler   *GenericHandler
+	ctx       context.Context
+	table     string
+	statement string
+	sql       string
+	args      []interface{}
+	start     time.Time
+	span      *tracing.Span
+}
+
+// startQuery begins measuring a statement of the given kind (select, count,
+// insert, update or delete). The returned context carries the statement's
+// span.
+func (h *GenericHandler) startQuery(ctx context.Context, table, statement, sql string, args []interface{}) (context.Context, *queryObservation) {
+	table = strings.ToLower(table)
+
+	ctx, span := tracing.Start(ctx, statement+" "+table, tracing.KindClient)
+	span.SetAttr("db.system", "mysql")
+	span.SetAttr("db.sql.table", table)
+	span.SetAttr("db.operation", statement)
+	span.SetAttr("db.statement", tracing.SanitizeSQL(sql))
+
+	return ctx, &queryObservation{
+		handler:   h,
+		ctx:       ctx,
+		table:     table,
+		statement: statement,
+		sql:       sql,
+		args:      args,
+		start:     time.Now(),
+		span:      span,
+	}
+}
+
+// end records the outcome; rows is the number of rows read or affected, or
+// -1 when unknown. It must be called from the function that started the
+// statement, which is logged as its caller.
+func (q *queryObservation) end(rows int64, err error) {
+	elapsed := time.Since(q.start)
+
+	metrics.QueryDuration.Observe(elapsed.Seconds(), q.table, q.statement)
+	if err != nil {
+		metrics.QueryErrors.Inc(q.table, q.statement)
+	}
+
+	q.handler.queryStats.Record(q.table, q.statement, q.sql, elapsed, err != nil)
+
+	if threshold := q.handler.slowQuery; threshold > 0 && elapsed >= threshold {
+		attrs := []any{
+			"sql", tracing.SanitizeSQL(q.sql),
+			"args", argShapes(q.args),
+			"duration_ms", float64(elapsed.Microseconds()) / 1000,
+			"rows", rows,
+			"caller", caller(1),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		slog.WarnContext(q.ctx, "Slow query", attrs...)
+	}
+
+	if rows >= 0 {
+		q.span.SetAttr("db.rows", rows)
+	}
+	q.span.SetError(err)
+	q.span.End()
+}
+
+// argShapes describes bound arguments by type and length without their
+// values, e.g. ["int64", "string(12)", "nil"]
+func argShapes(args []interface{}) []string {
+	shapes := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			shapes[i] = "nil"
+		case string:
+			shapes[i] = fmt.Sprintf("string(%d)", len(v))
+		case []byte:
+			shapes[i] = fmt.Sprintf("bytes(%d)", len(v))
+		default:
+			shapes[i] = fmt.Sprintf("%T", v)
+		}
+	}
+	return shapes
+}
+
+// caller returns the function and line skip frames above the caller of
+// caller
+func caller(skip int) string {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	name := filepath.Base(file)
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+	}
+	return fmt.Sprintf("%s:%d", name, line)
+}
+
+// affectedRows returns the rows affected by result, or -1 when unknown
+func affectedRows(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// writeStatement returns the statement kind executed for op
+func writeStatement(op security.Operation) string {
+	switch op {
+	case security.OperationCreate:
+		return "insert"
+	case security.OperationUpdate:
+		return "update"
+	case security.OperationDelete:
+		return "delete"
+	default:
+		return "select"
+	}
+}
+
+// sendValidationError counts the rejected fields of a write to table and
+// sends them
+func sendValidationError(w http.ResponseWriter, r *http.Request, table string, errs validation.ValidationErrors) {
+	table = strings.ToLower(table)
+	for _, e := range errs {
+		metrics.ValidationFailures.Inc(table, e.Code)
+	}
+	SendValidationError(w, r, errs)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/proyaai/instantgate/internal/query"
+)
+
+// QueryStatsHandler serves the rolling statistics of the statements run for
+// API requests, to find the filters that need indexes
+type QueryStatsHandler struct {
+	stats *query.Stats
+}
+
+func NewQueryStatsHandler(stats *query.Stats) *QueryStatsHandler {
+	return &QueryStatsHandler{stats: stats}
+}
+
+type QueryStatsResponse struct {
+	Window  string             `json:"window"`
+	Queries []query.ShapeStats `json:"queries"`
+}
+
+// Get lists the statement shapes of the window, optionally restricted by
+// the table parameter. Sort is p50, p95, p99, max, total, count or errors,
+// descending; p95 by default. Limit caps the number of shapes.
+func (h *QueryStatsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.stats == nil {
+		SendError(w, r, http.StatusNotFound, "Query statistics are disabled", nil)
+		return
+	}
+
+	by, ok := queryStatsOrder[r.URL.Query().Get("sort")]
+	if !ok {
+		SendError(w, r, http.StatusBadRequest, "Unknown sort, use p50, p95, p99, max, total, count or errors", nil)
+		return
+	}
+
+	queries := h.stats.Snapshot(r.URL.Query().Get("table"))
+	sort.SliceStable(queries, func(i, j int) bool {
+		return by(&queries[i]) > by(&queries[j])
+	})
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			SendError(w, r, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		if limit < len(queries) {
+			queries = queries[:limit]
+		}
+	}
+
+	SendJSON(w, r, http.StatusOK, QueryStatsResponse{
+		Window:  h.stats.Window().String(),
+		Queries: queries,
+	})
+}
+
+// Reset drops the collected statistics
+func (h *QueryStatsHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	h.stats.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var queryStatsOrder = map[string]func(*query.ShapeStats) float64{
+	"":       func(s *query.ShapeStats) float64 { return s.P95 },
+	"p50":    func(s *query.ShapeStats) float64 { return s.P50 },
+	"p95":    func(s *query.ShapeStats) float64 { return s.P95 },
+	"p99":    func(s *query.ShapeStats) float64 { return s.P99 },
+	"max":    func(s *query.ShapeStats) float64 { return s.Max },
+	"total":  func(s *query.ShapeStats) float64 { return s.Total },
+	"count":  func(s *query.ShapeStats) float64 { return float64(s.Count) },
+	"errors": func(s *query.ShapeStats) float64 { return float64(s.Errors) },
+}
@@ -2,23 +2,80 @@ package handlers
 
 import (
 	"net/http"
+	"sort"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
 )
 
 type SchemaHandler struct {
 	schemaCache *mysql.SchemaCache
+	columns     *security.ColumnPolicies
+	tenants     *tenant.Resolver
+	access      *security.AccessControl
+	roles       *security.RolePolicy
 }
 
-func NewSchemaHandler(cache *mysql.SchemaCache) *SchemaHandler {
+func NewSchemaHandler(cache *mysql.SchemaCache, columns *security.ColumnPolicies, tenants *tenant.Resolver, access *security.AccessControl, roles *security.RolePolicy) *SchemaHandler {
 	return &SchemaHandler{
 		schemaCache: cache,
+		columns:     columns,
+		tenants:     tenants,
+		access:      access,
+		roles:       roles,
 	}
 }
 
+// canAccess reports whether the caller may use table at all, so tables
+// hidden by the access lists, the identity's table scope or the role
+// permissions are not revealed
+func (h *SchemaHandler) canAccess(r *http.Request, table string) bool {
+	if !h.access.IsTableAllowed(table) {
+		return false
+	}
+
+	claims, _ := security.ClaimsFromContext(r.Context())
+	if !claims.TableAllowed(table) {
+		return false
+	}
+
+	return h.roles.CanAccess(security.CallerRoles(claims), table)
+}
+
+// schemaFor returns the schema of the request tenant in schema mode, or the
+// shared schema otherwise
+func (h *SchemaHandler) schemaFor(r *http.Request) (*mysql.SchemaCache, error) {
+	tenantID, ok := tenant.FromContext(r.Context())
+	if !ok {
+		return h.schemaCache, nil
+	}
+
+	conn, err := h.tenants.Conn(r.Context(), tenantID)
+	if err != nil || conn == nil {
+		return h.schemaCache, err
+	}
+	// Only the schema is used, which stays valid after the pool is closed
+	conn.Release()
+	return conn.Schema, nil
+}
+
 func (h *SchemaHandler) ListTables(w http.ResponseWriter, r *http.Request) {
-	tables := h.schemaCache.GetTables()
+	schemaCache, err := h.schemaFor(r)
+	if err != nil {
+		SendError(w, r, http.StatusServiceUnavailable, ErrDatabaseError, err)
+		return
+	}
+
+	all := schemaCache.GetTables()
+	tables := make([]string, 0, len(all))
+	for _, table := range all {
+		if h.canAccess(r, table) {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
 
 	response := map[string]interface{}{
 		"tables": tables,
@@ -31,21 +88,38 @@ func (h *SchemaHandler) ListTables(w http.ResponseWriter, r *http.Request) {
 func (h *SchemaHandler) GetTableSchema(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "table")
 
-	schema, exists := h.schemaCache.Get(tableName)
-	if !exists {
+	schemaCache, err := h.schemaFor(r)
+	if err != nil {
+		SendError(w, r, http.StatusServiceUnavailable, ErrDatabaseError, err)
+		return
+	}
+
+	schema, exists := schemaCache.Get(tableName)
+	if !exists || !h.canAccess(r, schema.Name) {
 		SendError(w, r, http.StatusNotFound, ErrTableNotFound, nil)
 		return
 	}
 
+	claims, _ := security.ClaimsFromContext(r.Context())
+	roles := security.CallerRoles(claims)
+
 	columns := make([]map[string]interface{}, 0, len(schema.Columns))
 	for _, col := range schema.Columns {
+		access := h.columns.ReadAccess(schema.Name, col.Name, roles)
+		if access == security.ReadNone {
+			continue
+		}
+
 		columns = append(columns, map[string]interface{}{
-			"name":            col.Name,
-			"type":            col.Type,
-			"go_type":         col.GoType,
-			"nullable":        col.Nullable,
-			"is_primary_key":  col.IsPrimaryKey,
+			"name":              col.Name,
+			"type":              col.Type,
+			"go_type":           col.GoType,
+			"nullable":          col.Nullable,
+			"is_primary_key":    col.IsPrimaryKey,
 			"is_auto_increment": col.IsAutoIncrement,
+			"read_only":         h.columns.IsReadOnly(schema.Name, col.Name),
+			"write_once":        h.columns.IsWriteOnce(schema.Name, col.Name),
+			"masked":            access == security.ReadMasked,
 		})
 	}
 
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/proyaai/instantgate/internal/api/handlers"
+	"github.com/proyaai/instantgate/internal/logging"
 	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
 )
 
 func TableAccessControl(ac *security.AccessControl) func(next http.Handler) http.Handler {
@@ -22,11 +25,83 @@ func TableAccessControl(ac *security.AccessControl) func(next http.Handler) http
 				return
 			}
 
+			if claims, ok := security.ClaimsFromContext(r.Context()); ok && !claims.TableAllowed(tableName) {
+				handlers.SendError(w, r, http.StatusForbidden, handlers.ErrForbidden, nil)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// Tenant resolves the tenant of each request and stores it in the context.
+// Requests without a resolvable tenant are rejected when tenancy is enabled.
+func Tenant(resolver *tenant.Resolver) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !resolver.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenantID, err := resolver.Resolve(r)
+			if errors.Is(err, tenant.ErrTenantMismatch) {
+				handlers.SendError(w, r, http.StatusForbidden, handlers.ErrForbidden, err)
+				return
+			}
+			if err != nil {
+				handlers.SendError(w, r, http.StatusBadRequest, "Tenant could not be resolved", err)
+				return
+			}
+
+			logging.SetTenant(r.Context(), tenantID)
+			next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), tenantID)))
+		})
+	}
+}
+
+// RolePermissions enforces the per-table, per-operation role policy.
+// Requests without valid claims are evaluated as the anonymous role.
+func RolePermissions(policy *security.RolePolicy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tableName := chi.URLParam(r, "table")
+			if tableName == "" || !policy.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, authenticated := GetClaims(r)
+
+			if !policy.IsAllowed(security.CallerRoles(claims), tableName, OperationFromMethod(r.Method)) {
+				if !authenticated {
+					handlers.SendError(w, r, http.StatusUnauthorized, handlers.ErrUnauthorized, nil)
+					return
+				}
+				handlers.SendError(w, r, http.StatusForbidden, handlers.ErrForbidden, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OperationFromMethod maps an HTTP method to the CRUD operation it performs
+func OperationFromMethod(method string) security.Operation {
+	switch method {
+	case http.MethodPost:
+		return security.OperationCreate
+	case http.MethodPut, http.MethodPatch:
+		return security.OperationUpdate
+	case http.MethodDelete:
+		return security.OperationDelete
+	default:
+		return security.OperationRead
+	}
+}
+
 func RequireAuth(requireAuth bool) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
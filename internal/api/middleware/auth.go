@@ -1,23 +1,59 @@
 package middleware
 
 import (
-	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/proyaai/instantgate/internal/api/handlers"
+	"github.com/proyaai/instantgate/internal/auth"
+	"github.com/proyaai/instantgate/internal/logging"
 	"github.com/proyaai/instantgate/internal/security"
 )
 
-type contextKey string
+// APIKeyAuth authenticates requests carrying an API key in the X-API-Key
+// header or as "Authorization: ApiKey <key>". Requests without a key are
+// left to the JWT middleware.
+func APIKeyAuth(store *auth.APIKeyStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := extractAPIKey(r)
+			if store == nil || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-const (
-	ClaimsContextKey contextKey = "claims"
-)
+			claims, err := store.Authenticate(r.Context(), key, clientIP(r))
+			if err != nil {
+				switch {
+				case errors.Is(err, auth.ErrAPIKeyIPNotAllowed):
+					handlers.SendError(w, r, http.StatusForbidden, handlers.ErrForbidden, err)
+				case errors.Is(err, auth.ErrInvalidAPIKey), errors.Is(err, auth.ErrAPIKeyExpired):
+					handlers.SendError(w, r, http.StatusUnauthorized, handlers.ErrUnauthorized, err)
+				default:
+					handlers.SendError(w, r, http.StatusInternalServerError, handlers.ErrDatabaseError, err)
+				}
+				return
+			}
+
+			ctx := security.WithClaims(r.Context(), claims)
+			logging.SetClaims(ctx, claims)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-func JWTAuth(jwtManager *security.JWTManager) func(next http.Handler) http.Handler {
+func JWTAuth(jwtManager *security.JWTManager, revocations *security.Revocations) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Already authenticated, e.g. by API key
+			if _, ok := GetClaims(r); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			token := extractToken(r)
 			if token == "" {
 				handlers.SendError(w, r, http.StatusUnauthorized, handlers.ErrUnauthorized, security.ErrNoToken)
@@ -30,16 +66,32 @@ func JWTAuth(jwtManager *security.JWTManager) func(next http.Handler) http.Handl
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+			revoked, err := revocations.IsRevoked(r.Context(), claims)
+			if err != nil {
+				handlers.SendError(w, r, http.StatusServiceUnavailable, "Token revocation check failed", err)
+				return
+			}
+			if revoked {
+				handlers.SendError(w, r, http.StatusUnauthorized, handlers.ErrUnauthorized, security.ErrTokenRevoked)
+				return
+			}
+
+			ctx := security.WithClaims(r.Context(), claims)
+			logging.SetClaims(ctx, claims)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func OptionalJWTAuth(jwtManager *security.JWTManager) func(next http.Handler) http.Handler {
+func OptionalJWTAuth(jwtManager *security.JWTManager, revocations *security.Revocations) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetClaims(r); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			token := extractToken(r)
 			if token == "" {
 				next.ServeHTTP(w, r)
@@ -52,7 +104,13 @@ func OptionalJWTAuth(jwtManager *security.JWTManager) func(next http.Handler) ht
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+			if revoked, err := revocations.IsRevoked(r.Context(), claims); err != nil || revoked {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := security.WithClaims(r.Context(), claims)
+			logging.SetClaims(ctx, claims)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -73,9 +131,30 @@ func extractToken(r *http.Request) string {
 	return parts[1]
 }
 
+func extractAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "apikey" {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// clientIP returns the address of the connecting client
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
 func GetClaims(r *http.Request) (*security.Claims, bool) {
-	claims, ok := r.Context().Value(ClaimsContextKey).(*security.Claims)
-	return claims, ok
+	return security.ClaimsFromContext(r.Context())
 }
 
 func RequireRole(roles ...string) func(next http.Handler) http.Handler {
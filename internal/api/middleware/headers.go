@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/cors"
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// CORS applies the configured CORS policy. Route overrides are matched by
+// the longest path prefix.
+func CORS(cfg *config.CORSConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+
+		type route struct {
+			prefix  string
+			handler http.Handler
+		}
+
+		routes := make([]route, 0, len(cfg.Routes))
+		for prefix, policy := range cfg.Routes {
+			routes = append(routes, route{
+				prefix:  prefix,
+				handler: corsOptions(policy.Inherit(cfg.CORSPolicy)).Handler(next),
+			})
+		}
+		sort.Slice(routes, func(i, j int) bool {
+			return len(routes[i].prefix) > len(routes[j].prefix)
+		})
+
+		global := corsOptions(cfg.CORSPolicy).Handler(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.ToLower(r.URL.Path)
+			for _, rt := range routes {
+				if strings.HasPrefix(path, rt.prefix) {
+					rt.handler.ServeHTTP(w, r)
+					return
+				}
+			}
+			global.ServeHTTP(w, r)
+		})
+	}
+}
+
+func corsOptions(policy config.CORSPolicy) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins:   policy.AllowedOrigins,
+		AllowedMethods:   policy.AllowedMethods,
+		AllowedHeaders:   policy.AllowedHeaders,
+		ExposedHeaders:   policy.ExposedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           int(policy.MaxAge.Seconds()),
+	})
+}
+
+// SecurityHeaders sets HSTS, content type, framing, CSP and referrer headers
+// on every response
+func SecurityHeaders(cfg *config.HeadersConfig) func(next http.Handler) http.Handler {
+	headers := make(map[string]string)
+	if cfg.Enabled {
+		if cfg.HSTSMaxAge > 0 {
+			hsts := fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds()))
+			if cfg.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			headers["Strict-Transport-Security"] = hsts
+		}
+		if cfg.ContentTypeOptions != "" {
+			headers["X-Content-Type-Options"] = cfg.ContentTypeOptions
+		}
+		if cfg.FrameOptions != "" {
+			headers["X-Frame-Options"] = cfg.FrameOptions
+		}
+		if cfg.ContentSecurityPolicy != "" {
+			headers["Content-Security-Policy"] = cfg.ContentSecurityPolicy
+		}
+		if cfg.ReferrerPolicy != "" {
+			headers["Referrer-Policy"] = cfg.ReferrerPolicy
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/proyaai/instantgate/internal/logging"
 )
 
 type responseWriter struct {
@@ -29,6 +31,8 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Logger logs one line per request once it has been answered. Records carry
+// the request attributes added by the logging handler.
 func Logger() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,32 +44,43 @@ func Logger() func(next http.Handler) http.Handler {
 				written:        false,
 			}
 
+			// The user and tenant are attached to inner contexts; the fields
+			// bring them back to this request line
+			r = r.WithContext(logging.WithFields(r.Context()))
 			next.ServeHTTP(rw, r)
 
-			duration := time.Since(start)
+			level := slog.LevelInfo
+			if rw.statusCode >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
 
-			log.Printf("[%s] %s %s - %d (%v)",
-				r.Method,
-				r.URL.Path,
-				r.RemoteAddr,
-				rw.statusCode,
-				duration,
+			slog.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.statusCode,
+				"duration_ms", float64(time.Since(start).Microseconds())/1000,
+				"remote_addr", r.RemoteAddr,
 			)
 		})
 	}
 }
 
-func RequestID() func(next http.Handler) http.Handler {
+// RequestID assigns every request an ID, stored in the request context and
+// echoed in X-Request-ID. An incoming X-Request-ID is kept only from trusted
+// proxies, so clients cannot choose the ID recorded in logs and audit
+// entries. It has to run before RealIP replaces the proxy address.
+func RequestID(trusted []*net.IPNet) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			requestID := r.Header.Get("X-Request-ID")
-			if requestID == "" {
+			if requestID == "" || !isTrusted(trusted, clientIP(r)) {
 				requestID = uuid.New().String()
 			}
 
 			w.Header().Set("X-Request-ID", requestID)
+			r.Header.Set("X-Request-ID", requestID)
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
 		})
 	}
 }
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/api/handlers"
+	"github.com/proyaai/instantgate/internal/metrics"
+)
+
+// Metrics records the count and latency of requests by route template,
+// table and operation. Known reports whether a table exists; other table
+// names are left out so clients cannot create arbitrary series.
+func Metrics(known func(table string) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(rw, r)
+
+			// The route is known once routing has finished
+			route, table, operation := "", "", ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+				if name := rctx.URLParam("table"); name != "" {
+					if known(name) {
+						table = strings.ToLower(name)
+					}
+					operation = routeOperation(r.Method, rctx.URLParam("id") != "")
+				}
+			}
+			if route == "" {
+				route = "unmatched"
+			}
+
+			method := methodLabel(r.Method)
+			status := strconv.Itoa(rw.statusCode)
+			metrics.HTTPRequests.Inc(method, route, table, operation, status)
+			metrics.HTTPDuration.Observe(metrics.Since(start), method, route, table, operation, status)
+		})
+	}
+}
+
+// routeOperation names the operation of a table route, telling lists from
+// reads of a single record
+func routeOperation(method string, record bool) string {
+	if method == http.MethodGet && !record {
+		return "list"
+	}
+	if method == http.MethodGet {
+		return "get"
+	}
+	return string(OperationFromMethod(method))
+}
+
+// methodLabel bounds the method label, which clients choose freely
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// BearerToken requires "Authorization: Bearer <token>". An empty token
+// allows every request.
+func BearerToken(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+
+		expected := []byte("Bearer " + token)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				handlers.SendError(w, r, http.StatusUnauthorized, handlers.ErrUnauthorized, nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/api/handlers"
+	"github.com/proyaai/instantgate/internal/ratelimit"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+// RateLimit enforces the configured rate limits and reports the state of
+// the most restrictive bucket in the X-RateLimit-* headers. Callers are
+// identified by their claims, or by client IP when unauthenticated.
+func RateLimit(limiter *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, _ := GetClaims(r)
+
+			table := chi.URLParam(r, "table")
+			var op security.Operation
+			if table != "" {
+				op = OperationFromMethod(r.Method)
+			}
+
+			ip := r.RemoteAddr
+			if addr := clientIP(r); addr != nil {
+				ip = addr.String()
+			}
+
+			res := limiter.Allow(r.Context(), claims, ip, table, op)
+
+			if res.Remaining >= 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			}
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				handlers.SendError(w, r, http.StatusTooManyRequests, "Rate limit exceeded", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func mustCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func TestForwardedIP(t *testing.T) {
+	trusted := mustCIDRs(t, "10.0.0.0/8", "fd00::/8")
+
+	tests := []struct {
+		name      string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{name: "single hop", forwarded: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "client prepended entries ignored", forwarded: []string{"1.2.3.4, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "trusted hops skipped", forwarded: []string{"203.0.113.7, 10.0.0.2, 10.0.0.1"}, want: "203.0.113.7"},
+		{name: "repeated headers joined", forwarded: []string{"1.2.3.4", "203.0.113.7, 10.0.0.1"}, want: "203.0.113.7"},
+		{name: "whitespace", forwarded: []string{" 203.0.113.7 ,10.0.0.1 "}, want: "203.0.113.7"},
+		{name: "ipv6", forwarded: []string{"2001:db8::1, fd00::1"}, want: "2001:db8::1"},
+		{name: "only trusted hops", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "invalid entry stops the walk", forwarded: []string{"203.0.113.7, bogus, 10.0.0.1"}, want: "10.0.0.1"},
+		{name: "invalid last entry", forwarded: []string{"203.0.113.7, bogus"}, realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "real ip fallback", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "no headers", want: "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := forwardedIP(r, trusted).String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		want       string
+	}{
+		{name: "trusted proxy", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:4000", want: "203.0.113.7"},
+		{name: "untrusted peer", trusted: []string{"10.0.0.0/8"}, remoteAddr: "192.0.2.9:4000", want: "192.0.2.9:4000"},
+		{name: "no trusted proxies", remoteAddr: "10.0.0.1:4000", want: "10.0.0.1:4000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(mustCIDRs(t, tt.trusted...))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Forwarded-For", "203.0.113.7")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
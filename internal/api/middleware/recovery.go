@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"fmt"
+	"log/slog"
 	"net/http"
-	"runtime/debug"
+	"runtime"
+	"strings"
 
 	"github.com/proyaai/instantgate/internal/api/handlers"
 )
@@ -12,9 +15,15 @@ func Recovery() func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
-					stack := debug.Stack()
-					println("PANIC:", err)
-					println(string(stack))
+					// Aborted responses are not errors of the handler
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+
+					slog.ErrorContext(r.Context(), "panic recovered",
+						"panic", fmt.Sprint(err),
+						"stack", stackFrames(3),
+					)
 
 					handlers.SendError(w, r, http.StatusInternalServerError, "Internal server error", nil)
 				}
@@ -24,3 +33,23 @@ func Recovery() func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// stackFrames returns the calling stack as "function file:line" entries,
+// skipping the frames of the runtime and of skip callers
+func stackFrames(skip int) []string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []string
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
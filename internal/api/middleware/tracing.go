@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/tracing"
+)
+
+// Tracing starts a server span for every request, continuing the trace of
+// an incoming traceparent header. The trace ID is returned in X-Trace-ID and
+// the request ID is recorded on the span, so either finds the other.
+func Tracing(tracer *tracing.Tracer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if tracer == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader))
+			ctx, span := tracer.StartRequest(r.Context(), r.Method, remote)
+			defer span.End()
+
+			w.Header().Set("X-Trace-ID", span.Context().TraceID.String())
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			r = r.WithContext(ctx)
+			next.ServeHTTP(rw, r)
+
+			// Spans are named after the route template to keep names bounded
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if route := rctx.RoutePattern(); route != "" {
+					span.SetName(r.Method + " " + route)
+					span.SetAttr("http.route", route)
+				}
+				if table := rctx.URLParam("table"); table != "" {
+					span.SetAttr("db.sql.table", table)
+				}
+			}
+
+			span.SetAttr("http.request.method", r.Method)
+			span.SetAttr("url.path", r.URL.Path)
+			span.SetAttr("http.response.status_code", rw.statusCode)
+			span.SetAttr("request.id", r.Header.Get("X-Request-ID"))
+			if rw.statusCode >= http.StatusInternalServerError {
+				span.SetError(errServerError(rw.statusCode))
+			}
+		})
+	}
+}
+
+// errServerError marks spans of requests answered with a 5xx status
+type errServerError int
+
+func (e errServerError) Error() string {
+	return http.StatusText(int(e))
+}
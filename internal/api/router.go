@@ -3,18 +3,27 @@ package api
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"github.com/proyaai/instantgate/internal/api/handlers"
 	mw "github.com/proyaai/instantgate/internal/api/middleware"
+	"github.com/proyaai/instantgate/internal/audit"
+	"github.com/proyaai/instantgate/internal/auth"
 	"github.com/proyaai/instantgate/internal/cache"
 	"github.com/proyaai/instantgate/internal/config"
 	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/logging"
+	"github.com/proyaai/instantgate/internal/metrics"
+	"github.com/proyaai/instantgate/internal/query"
+	"github.com/proyaai/instantgate/internal/ratelimit"
 	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
+	"github.com/proyaai/instantgate/internal/tracing"
 	"github.com/proyaai/instantgate/internal/validation"
 )
 
@@ -25,21 +34,86 @@ type Server struct {
 	schemaCache       *mysql.SchemaCache
 	jwtManager        *security.JWTManager
 	accessControl     *security.AccessControl
+	columnPolicies    *security.ColumnPolicies
+	rolePolicy        *security.RolePolicy
+	acl               *security.ACLManager
+	rowPolicies       *security.RowPolicies
+	tenants           *tenant.Resolver
+	revocations       *security.Revocations
+	apiKeys           *auth.APIKeyStore
+	limiter           *ratelimit.Limiter
+	auditor           *audit.Auditor
 	validationManager *validation.ValidationManager
 	cache             *cache.Cache
+	cacheBackend      cache.Backend
+	tracer            *tracing.Tracer
+	logger            *slog.Logger
 	healthHandler     *handlers.HealthHandler
 	schemaHandler     *handlers.SchemaHandler
 	genericHandler    *handlers.GenericHandler
+	authHandler       *handlers.AuthHandler
+	aclHandler        *handlers.ACLHandler
+	queryStatsHandler *handlers.QueryStatsHandler
 	httpServer        *http.Server
 }
 
 func NewServer(cfg *config.Config) (*Server, error) {
+	logger, err := logging.Setup(&cfg.Logging)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		config:        cfg,
-		router:        chi.NewRouter(),
-		accessControl: security.NewAccessControl(&cfg.Security),
-		jwtManager:    security.NewJWTManager(&cfg.JWT),
+		config: cfg,
+		router: chi.NewRouter(),
+		logger: logger,
+	}
+
+	accessControl, err := security.NewAccessControl(&cfg.Security)
+	if err != nil {
+		return nil, err
+	}
+	s.accessControl = accessControl
+
+	jwtManager, err := security.NewJWTManager(&cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize JWT: %w", err)
+	}
+	s.jwtManager = jwtManager
+
+	tracer, err := tracing.New(&cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	s.tracer = tracer
+
+	// Password hashes of the login users table are never readable through the
+	// API, and the columns deciding who a user is and what they may do are
+	// not writable, so callers cannot grant themselves roles or passwords
+	if cfg.Auth.Enabled {
+		protectAuthColumns(cfg)
+	}
+
+	s.columnPolicies = security.NewColumnPolicies(cfg.Security.Columns, []byte(cfg.Security.MaskSecret))
+	s.rolePolicy = security.NewRolePolicy(cfg.Security.Roles)
+
+	acl, err := security.NewACLManager(cfg, s.accessControl, s.rolePolicy)
+	if err != nil {
+		return nil, err
+	}
+	s.acl = acl
+	if cfg.Security.WatchACL {
+		if err := s.acl.Watch(); err != nil {
+			slog.Warn("Access lists will not be reloaded on file changes", "error", err)
+		}
+	}
+	s.aclHandler = handlers.NewACLHandler(s.acl)
+
+	rowPolicies, err := security.NewRowPolicies(cfg.Security.RowPolicies)
+	if err != nil {
+		return nil, err
 	}
+	s.rowPolicies = rowPolicies
 
 	s.introspector = mysql.NewIntrospector(&cfg.Database)
 
@@ -55,60 +129,192 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to load schema: %w", err)
 	}
 	s.schemaCache = schemaCache
+	s.accessControl.SetTables(s.schemaCache.GetTables())
 
 	if cfg.Redis.Host != "" {
 		cache, err := cache.NewCache(&cfg.Redis)
 		if err != nil {
-			fmt.Printf("Warning: failed to initialize Redis cache: %v\n", err)
+			slog.Warn("Failed to initialize Redis cache", "error", err)
 		} else {
 			s.cache = cache
 		}
 	}
 
-	s.healthHandler = handlers.NewHealthHandler(s.introspector.GetDB())
-	s.schemaHandler = handlers.NewSchemaHandler(s.schemaCache)
+	cacheBackend, err := cache.NewBackend(&cfg.Cache, s.cache, cfg.Redis.CacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheBackend = cacheBackend
+
+	s.limiter = ratelimit.NewLimiter(&cfg.RateLimit, s.cache)
+
+	// Revocation entries live as long as the longest accepted token
+	maxLifetime := cfg.JWT.Expiry
+	if cfg.JWT.RefreshExpiry > maxLifetime {
+		maxLifetime = cfg.JWT.RefreshExpiry
+	}
+	s.revocations = security.NewRevocations(s.cache, maxLifetime+cfg.JWT.Leeway)
+
+	s.healthHandler = handlers.NewHealthHandler(s.introspector.GetDB(), s.schemaCache, s.cache, redisRequired(cfg, s.limiter), s.cacheBackend, cfg.Health.Timeout)
+	if cfg.Metrics.Enabled {
+		metrics.Default.SetFunc("db", metrics.DBStats(s.introspector.GetDB()))
+	}
+	s.tenants = tenant.NewResolver(&cfg.Tenancy, &cfg.Database, s.schemaCache)
+	s.schemaHandler = handlers.NewSchemaHandler(s.schemaCache, s.columnPolicies, s.tenants, s.accessControl, s.rolePolicy)
 	s.validationManager = validation.NewValidationManager(&cfg.Validation, s.schemaCache)
-	s.genericHandler = handlers.NewGenericHandler(s.introspector.GetDB(), s.schemaCache, s.validationManager)
+	auditor, err := audit.NewAuditor(&cfg.Audit)
+	if err != nil {
+		return nil, err
+	}
+	s.auditor = auditor
+
+	var flight *cache.Flight
+	if cfg.Cache.Coalesce {
+		flight = cache.NewFlight()
+	}
+
+	queryStats := query.NewStats(&cfg.QueryStats)
+	s.queryStatsHandler = handlers.NewQueryStatsHandler(queryStats)
+
+	s.genericHandler = handlers.NewGenericHandler(s.introspector.GetDB(), s.schemaCache, s.validationManager, s.columnPolicies, s.rowPolicies, s.tenants, s.auditor, cache.NewResponseCache(s.cacheBackend, &cfg.Cache, cfg.Redis.CacheTTL), flight, queryStats, cfg.QueryStats.SlowThreshold)
+
+	var users *auth.UserStore
+	if cfg.Auth.Enabled {
+		users = auth.NewUserStore(s.introspector.GetDB(), &cfg.Auth)
+	}
+	s.authHandler = handlers.NewAuthHandler(users, s.jwtManager, s.revocations)
+
+	if cfg.Security.APIKeys.Enabled {
+		apiKeys, err := auth.NewAPIKeyStore(s.introspector.GetDB(), &cfg.Security.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		s.apiKeys = apiKeys
+	}
 
 	s.setupRoutes()
 
 	return s, nil
 }
 
+// redisRequired reports whether readiness depends on Redis: it is required
+// when it backs the response cache or the rate limits, or when configured
+// so. redis.host has a default, so a host alone does not make it required.
+func redisRequired(cfg *config.Config, limiter *ratelimit.Limiter) bool {
+	if cfg.Health.RequireRedis || limiter.UsesRedis() {
+		return true
+	}
+	switch strings.ToLower(cfg.Cache.Backend) {
+	case "redis", "tiered":
+		return cfg.Cache.Enabled
+	}
+	return false
+}
+
+// protectAuthColumns adds the column policies of the login tables to cfg
+func protectAuthColumns(cfg *config.Config) {
+	if cfg.Security.Columns == nil {
+		cfg.Security.Columns = make(map[string]config.ColumnPolicyConfig)
+	}
+
+	users := strings.ToLower(cfg.Auth.UsersTable)
+	policy := cfg.Security.Columns[users]
+	policy.Hidden = append(policy.Hidden, cfg.Auth.PasswordColumn)
+	if cfg.Auth.RolesTable == "" {
+		policy.ReadOnly = append(policy.ReadOnly, cfg.Auth.RolesColumn)
+	}
+	if cfg.Tenancy.Enabled && cfg.Tenancy.Mode == "column" {
+		policy.ReadOnly = append(policy.ReadOnly, cfg.Tenancy.Column)
+	}
+	cfg.Security.Columns[users] = policy
+
+	if cfg.Auth.RolesTable != "" {
+		roles := strings.ToLower(cfg.Auth.RolesTable)
+		policy := cfg.Security.Columns[roles]
+		policy.ReadOnly = append(policy.ReadOnly, cfg.Auth.RolesUserColumn, cfg.Auth.RolesNameColumn)
+		cfg.Security.Columns[roles] = policy
+	}
+}
+
 func (s *Server) setupRoutes() {
-	s.router.Use(middleware.Recoverer)
-	s.router.Use(middleware.Logger)
-	s.router.Use(middleware.RequestID)
 	s.router.Use(middleware.Timeout(60 * time.Second))
 
-	s.router.Use(mw.Recovery())
+	// Proxies were validated with the config
+	proxies, _ := s.config.Server.TrustedProxyNets()
+	s.router.Use(mw.RequestID(proxies))
+	s.router.Use(mw.RealIP(proxies))
+
+	// Tracing comes first so every log line carries the trace ID; the
+	// recovery middleware comes last so panics are logged, counted and
+	// traced as 500s
+	s.router.Use(mw.Tracing(s.tracer))
 	s.router.Use(mw.Logger())
-	s.router.Use(mw.RequestID())
-
-	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"X-Total-Count", "X-Limit", "X-Offset", "X-Request-ID"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	})
-	s.router.Use(corsMiddleware.Handler)
+	if s.config.Metrics.Enabled {
+		s.router.Use(mw.Metrics(s.schemaCache.TableExists))
+	}
+	s.router.Use(mw.Recovery())
+
+	s.router.Use(mw.SecurityHeaders(&s.config.Headers))
+	s.router.Use(mw.CORS(&s.config.CORS))
 
 	s.router.Get("/health", s.healthHandler.Check)
+	s.router.Get("/health/live", s.healthHandler.Live)
+	s.router.Get("/health/ready", s.healthHandler.Ready)
+	s.router.With(
+		mw.APIKeyAuth(s.apiKeys),
+		mw.JWTAuth(s.jwtManager, s.revocations),
+		mw.RequireRole(s.config.Security.AdminRoles...),
+	).Get("/health/details", s.healthHandler.Details)
+	if s.config.Metrics.Enabled {
+		s.router.With(mw.BearerToken(s.config.Metrics.Token)).Method(http.MethodGet, s.config.Metrics.Path, metrics.Default.Handler())
+	}
+
+	if s.config.Auth.Enabled {
+		// Login attempts are limited per client IP
+		s.router.With(mw.RateLimit(s.limiter)).Post("/auth/login", s.authHandler.Login)
+		s.router.With(mw.RateLimit(s.limiter)).Post("/auth/refresh", s.authHandler.Refresh)
+	}
+	s.router.With(mw.JWTAuth(s.jwtManager, s.revocations)).Post("/auth/logout", s.authHandler.Logout)
+
+	s.router.Route("/admin", func(r chi.Router) {
+		r.Use(mw.APIKeyAuth(s.apiKeys))
+		r.Use(mw.JWTAuth(s.jwtManager, s.revocations))
+		r.Use(mw.RequireRole(s.config.Security.AdminRoles...))
+
+		r.Post("/revoke", s.authHandler.Revoke)
+
+		r.Get("/acl", s.aclHandler.Get)
+		r.Put("/acl", s.aclHandler.Replace)
+		r.Post("/acl/reload", s.aclHandler.Reload)
+		r.Put("/acl/roles/{role}", s.aclHandler.SetRole)
+		r.Delete("/acl/roles/{role}", s.aclHandler.DeleteRole)
+		r.Post("/acl/{list}", s.aclHandler.AddTable)
+		r.Delete("/acl/{list}/{table}", s.aclHandler.RemoveTable)
+
+		r.Get("/queries", s.queryStatsHandler.Get)
+		r.Delete("/queries", s.queryStatsHandler.Reset)
+	})
 
 	apiRouter := chi.NewRouter()
 
+	apiRouter.Use(mw.APIKeyAuth(s.apiKeys))
+
 	if s.config.Security.RequireAuth {
-		apiRouter.Use(mw.JWTAuth(s.jwtManager))
+		apiRouter.Use(mw.JWTAuth(s.jwtManager, s.revocations))
 	} else {
-		apiRouter.Use(mw.OptionalJWTAuth(s.jwtManager))
+		apiRouter.Use(mw.OptionalJWTAuth(s.jwtManager, s.revocations))
 	}
+	apiRouter.Use(mw.Tenant(s.tenants))
 
-	apiRouter.Get("/schema", s.schemaHandler.ListTables)
-	apiRouter.Get("/schema/{table}", s.schemaHandler.GetTableSchema)
+	limited := apiRouter.With(mw.RateLimit(s.limiter))
 
-	crudGroup := apiRouter.With(mw.TableAccessControl(s.accessControl))
+	limited.Get("/schema", s.schemaHandler.ListTables)
+	limited.Get("/schema/{table}", s.schemaHandler.GetTableSchema)
+
+	crudGroup := limited.With(
+		mw.TableAccessControl(s.accessControl),
+		mw.RolePermissions(s.rolePolicy),
+	)
 
 	crudGroup.Get("/{table}", s.genericHandler.ListTable)
 	crudGroup.Get("/{table}/{id}", s.genericHandler.GetByID)
@@ -121,7 +327,7 @@ func (s *Server) setupRoutes() {
 	s.router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		handlers.SendJSON(w, r, http.StatusOK, map[string]interface{}{
 			"name":        "InstantGate API",
-			"version":     "1.0.0",
+			"version":     handlers.Version,
 			"description": "Instant REST API for any relational database",
 		})
 	})
@@ -134,33 +340,69 @@ func (s *Server) Start() error {
 		ReadTimeout:  s.config.Server.ReadTimeout,
 		WriteTimeout: s.config.Server.WriteTimeout,
 		IdleTimeout:  s.config.Server.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
 	}
 
-	fmt.Printf("Starting InstantGate API on port %d\n", s.config.Server.Port)
+	slog.Info("Starting InstantGate API", "port", s.config.Server.Port)
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	var errs []error
 
+	// Readiness fails from here on; the drain delay lets load balancers
+	// notice before connections are refused
+	s.healthHandler.Drain()
+	if delay := s.config.Health.DrainDelay; delay > 0 && s.httpServer != nil {
+		slog.Info("Draining before shutdown", "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
 	if s.httpServer != nil {
 		if err := s.httpServer.Shutdown(ctx); err != nil {
 			errs = append(errs, fmt.Errorf("HTTP server shutdown: %w", err))
 		}
 	}
 
+	if err := s.acl.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("ACL watcher close: %w", err))
+	}
+
+	if err := s.tenants.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("tenant databases close: %w", err))
+	}
+
+	if err := s.auditor.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("audit log close: %w", err))
+	}
+
 	if s.introspector != nil {
 		if err := s.introspector.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("database close: %w", err))
 		}
 	}
 
+	// The Redis backend is closed with the Redis cache below
+	if s.cacheBackend != nil && s.cacheBackend != cache.Backend(s.cache) {
+		if err := s.cacheBackend.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("cache backend close: %w", err))
+		}
+	}
+
 	if s.cache != nil {
 		if err := s.cache.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("cache close: %w", err))
 		}
 	}
 
+	// Last, so spans of the shutdown above are exported
+	if err := s.tracer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("tracer close: %w", err))
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("shutdown errors: %v", errs)
 	}
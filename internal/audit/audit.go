@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/logging"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tenant"
+)
+
+// Entry describes one change of a record
+type Entry struct {
+	Time      time.Time              `json:"time"`
+	Actor     string                 `json:"actor,omitempty"`
+	ActorName string                 `json:"actor_name,omitempty"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Table     string                 `json:"table"`
+	Key       string                 `json:"key"`
+	Operation string                 `json:"operation"`
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+	Changes   map[string]Change      `json:"changes,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+}
+
+// Change is the old and new value of a column
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Sink stores audit entries. tx is the transaction of the change, which
+// transactional sinks write to so the entry commits with the change.
+type Sink interface {
+	Write(ctx context.Context, tx *sql.Tx, entry *Entry) error
+	Transactional() bool
+	Close() error
+}
+
+// Auditor records the changes of the audited tables
+type Auditor struct {
+	cfg     *config.AuditConfig
+	sink    Sink
+	exclude map[string]map[string]bool
+}
+
+func NewAuditor(cfg *config.AuditConfig) (*Auditor, error) {
+	a := &Auditor{
+		cfg:     cfg,
+		exclude: make(map[string]map[string]bool, len(cfg.Exclude)),
+	}
+
+	for table, columns := range cfg.Exclude {
+		set := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			set[strings.ToLower(column)] = true
+		}
+		a.exclude[strings.ToLower(table)] = set
+	}
+
+	if !cfg.Enabled {
+		return a, nil
+	}
+
+	switch cfg.Sink {
+	case "database":
+		a.sink = NewDatabaseSink(cfg.Table)
+	case "file":
+		sink, err := NewFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		a.sink = sink
+	default:
+		a.sink = NewStdoutSink()
+	}
+
+	return a, nil
+}
+
+// Enabled reports whether changes of table are audited
+func (a *Auditor) Enabled(table string) bool {
+	if a == nil || !a.cfg.Enabled {
+		return false
+	}
+
+	table = strings.ToLower(table)
+	for _, pattern := range a.cfg.Tables {
+		if matched, err := path.Match(strings.ToLower(pattern), table); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Transactional reports whether entries must be written before the change
+// is committed
+func (a *Auditor) Transactional() bool {
+	return a.sink.Transactional()
+}
+
+// NewEntry describes a change made by the request r. Before is nil for
+// creates and after is nil for deletes.
+func (a *Auditor) NewEntry(r *http.Request, table string, op security.Operation, key interface{}, before, after map[string]interface{}) *Entry {
+	entry := &Entry{
+		Time:      time.Now().UTC(),
+		Table:     table,
+		Key:       fmt.Sprint(key),
+		Operation: string(op),
+		Before:    a.redact(table, before),
+		After:     a.redact(table, after),
+		RequestID: logging.RequestID(r.Context()),
+		IP:        remoteIP(r),
+	}
+
+	if claims, ok := security.ClaimsFromContext(r.Context()); ok {
+		entry.Actor = claims.UserID
+		entry.ActorName = claims.Username
+	}
+	if id, ok := tenant.FromContext(r.Context()); ok {
+		entry.Tenant = id
+	}
+
+	if entry.Before != nil && entry.After != nil {
+		entry.Changes = diff(entry.Before, entry.After)
+	}
+
+	return entry
+}
+
+// Record writes entry to the sink
+func (a *Auditor) Record(ctx context.Context, tx *sql.Tx, entry *Entry) error {
+	if err := a.sink.Write(ctx, tx, entry); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+func (a *Auditor) Close() error {
+	if a == nil || a.sink == nil {
+		return nil
+	}
+	return a.sink.Close()
+}
+
+// redact returns a copy of row without the excluded columns
+func (a *Auditor) redact(table string, row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+
+	tableExcluded := a.exclude[strings.ToLower(table)]
+	allExcluded := a.exclude["*"]
+
+	result := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		lower := strings.ToLower(column)
+		if tableExcluded[lower] || allExcluded[lower] {
+			continue
+		}
+		result[column] = value
+	}
+	return result
+}
+
+// diff returns the columns whose value differs between before and after
+func diff(before, after map[string]interface{}) map[string]Change {
+	changes := make(map[string]Change)
+	for column, newValue := range after {
+		oldValue := before[column]
+		if fmt.Sprint(oldValue) != fmt.Sprint(newValue) {
+			changes[column] = Change{Old: oldValue, New: newValue}
+		}
+	}
+	return changes
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
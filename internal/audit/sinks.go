@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// DatabaseSink inserts entries into an audit table within the transaction
+// of the change. The table needs the columns occurred_at, actor, tenant,
+// table_name, record_key, operation, before_data, after_data, changes,
+// request_id and ip_address.
+type DatabaseSink struct {
+	table string
+	sb    sq.StatementBuilderType
+}
+
+func NewDatabaseSink(table string) *DatabaseSink {
+	return &DatabaseSink{
+		table: table,
+		sb:    sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+}
+
+func (s *DatabaseSink) Write(ctx context.Context, tx *sql.Tx, entry *Entry) error {
+	if tx == nil {
+		return fmt.Errorf("database audit sink requires a transaction")
+	}
+
+	before, err := jsonColumn(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := jsonColumn(entry.After)
+	if err != nil {
+		return err
+	}
+	changes, err := jsonColumn(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := s.sb.
+		Insert("`"+strings.ReplaceAll(s.table, "`", "``")+"`").
+		Columns("occurred_at", "actor", "tenant", "table_name", "record_key", "operation",
+			"before_data", "after_data", "changes", "request_id", "ip_address").
+		Values(entry.Time, entry.Actor, entry.Tenant, entry.Table, entry.Key, entry.Operation,
+			before, after, changes, entry.RequestID, entry.IP).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *DatabaseSink) Transactional() bool {
+	return true
+}
+
+func (s *DatabaseSink) Close() error {
+	return nil
+}
+
+// jsonColumn encodes v for a JSON column, or NULL when v is nil
+func jsonColumn(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// WriterSink writes entries as JSON lines
+type WriterSink struct {
+	w      io.Writer
+	closer io.Closer
+	mu     sync.Mutex
+}
+
+// NewFileSink appends entries to a JSON lines file
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &WriterSink{w: f, closer: f}, nil
+}
+
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{w: os.Stdout}
+}
+
+func (s *WriterSink) Write(ctx context.Context, tx *sql.Tx, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *WriterSink) Transactional() bool {
+	return false
+}
+
+func (s *WriterSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
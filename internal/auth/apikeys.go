@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+// TokenTypeAPIKey is the token type of identities authenticated by API key
+const TokenTypeAPIKey = "api_key"
+
+// APIKey is a configured key without its secret
+type APIKey struct {
+	Name       string
+	Hash       string
+	Roles      []string
+	Tables     []string
+	ExpiresAt  time.Time
+	AllowedIPs []*net.IPNet
+	Tenant     string
+}
+
+// APIKeyStore authenticates API keys against the configured keys and the
+// optional keys table
+type APIKeyStore struct {
+	db   *sql.DB
+	cfg  *config.APIKeysConfig
+	sb   sq.StatementBuilderType
+	keys []*APIKey
+}
+
+func NewAPIKeyStore(db *sql.DB, cfg *config.APIKeysConfig) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		db:  db,
+		cfg: cfg,
+		sb:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+
+	for _, kc := range cfg.Keys {
+		key := &APIKey{
+			Name:   kc.Name,
+			Hash:   strings.ToLower(kc.Hash),
+			Roles:  kc.Roles,
+			Tables: kc.Tables,
+			Tenant: kc.Tenant,
+		}
+
+		if kc.ExpiresAt != "" {
+			expires, err := time.Parse(time.RFC3339, kc.ExpiresAt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expires_at for API key %s: %w", kc.Name, err)
+			}
+			key.ExpiresAt = expires
+		}
+
+		nets, err := parseAllowedIPs(kc.AllowedIPs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_ips for API key %s: %w", kc.Name, err)
+		}
+		key.AllowedIPs = nets
+
+		s.keys = append(s.keys, key)
+	}
+
+	return s, nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash stored for a key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate resolves key into claims for a request from remoteIP
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string, remoteIP net.IP) (*security.Claims, error) {
+	hash := HashAPIKey(key)
+
+	apiKey, err := s.find(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if len(apiKey.AllowedIPs) > 0 && !ipAllowed(apiKey.AllowedIPs, remoteIP) {
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+
+	return &security.Claims{
+		UserID:    "apikey:" + apiKey.Name,
+		Username:  apiKey.Name,
+		Roles:     apiKey.Roles,
+		Tables:    apiKey.Tables,
+		TenantID:  apiKey.Tenant,
+		TokenType: TokenTypeAPIKey,
+	}, nil
+}
+
+func (s *APIKeyStore) find(ctx context.Context, hash string) (*APIKey, error) {
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) == 1 {
+			return key, nil
+		}
+	}
+
+	if s.cfg.Table == "" || s.db == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return s.findInTable(ctx, hash)
+}
+
+// findInTable looks up a key in the keys table. Roles, tables and allowed
+// IPs are comma separated lists or JSON arrays; expiry and tenant may be NULL.
+func (s *APIKeyStore) findInTable(ctx context.Context, hash string) (*APIKey, error) {
+	columns := []string{
+		quoteIdentifier(s.cfg.NameColumn),
+		quoteIdentifier(s.cfg.RolesColumn),
+		quoteIdentifier(s.cfg.TablesColumn),
+		quoteIdentifier(s.cfg.ExpiresColumn),
+		quoteIdentifier(s.cfg.AllowedIPsColumn),
+	}
+	if s.cfg.TenantColumn != "" {
+		columns = append(columns, quoteIdentifier(s.cfg.TenantColumn))
+	}
+
+	query, args, err := s.sb.
+		Select(columns...).
+		From(quoteIdentifier(s.cfg.Table)).
+		Where(sq.Eq{quoteIdentifier(s.cfg.HashColumn): hash}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var name, roles, tables, allowedIPs, tenant sql.NullString
+	var expires sql.NullTime
+	dest := []interface{}{&name, &roles, &tables, &expires, &allowedIPs}
+	if s.cfg.TenantColumn != "" {
+		dest = append(dest, &tenant)
+	}
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to query API keys table: %w", err)
+	}
+
+	nets, err := parseAllowedIPs(parseList(allowedIPs.String))
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed IPs for API key %s: %w", name.String, err)
+	}
+
+	return &APIKey{
+		Name:       name.String,
+		Hash:       hash,
+		Roles:      parseList(roles.String),
+		Tables:     parseList(tables.String),
+		ExpiresAt:  expires.Time,
+		AllowedIPs: nets,
+		Tenant:     tenant.String,
+	}, nil
+}
+
+// parseAllowedIPs parses IP addresses and CIDR ranges
+func parseAllowedIPs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func ipAllowed(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrAPIKeyExpired      = errors.New("API key has expired")
+	ErrAPIKeyIPNotAllowed = errors.New("API key is not allowed from this address")
+)
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	// echo -n "test" | sha256sum
+	want := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if got := HashAPIKey("test"); got != want {
+		t.Errorf("HashAPIKey = %s, want %s", got, want)
+	}
+}
+
+func TestAPIKeyStoreAuthenticate(t *testing.T) {
+	store, err := NewAPIKeyStore(nil, &config.APIKeysConfig{
+		Enabled: true,
+		Keys: []config.APIKeyConfig{
+			{
+				Name:   "billing",
+				Hash:   "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08",
+				Roles:  []string{"editor"},
+				Tables: []string{"invoice*"},
+				Tenant: "acme",
+			},
+			{Name: "expired", Hash: HashAPIKey("old"), ExpiresAt: "2000-01-01T00:00:00Z"},
+			{Name: "future", Hash: HashAPIKey("new"), ExpiresAt: "2999-01-01T00:00:00Z"},
+			{Name: "office", Hash: HashAPIKey("office"), AllowedIPs: []string{"10.0.0.0/8", "2001:db8::1"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAPIKeyStore: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		ip       string
+		wantName string
+		wantErr  error
+	}{
+		{name: "valid key", key: "test", ip: "192.0.2.1", wantName: "billing"},
+		{name: "unknown key", key: "nope", ip: "192.0.2.1", wantErr: ErrInvalidAPIKey},
+		{name: "expired key", key: "old", ip: "192.0.2.1", wantErr: ErrAPIKeyExpired},
+		{name: "key expiring later", key: "new", ip: "192.0.2.1", wantName: "future"},
+		{name: "allowed range", key: "office", ip: "10.1.2.3", wantName: "office"},
+		{name: "allowed single ipv6", key: "office", ip: "2001:db8::1", wantName: "office"},
+		{name: "address outside allowlist", key: "office", ip: "192.0.2.1", wantErr: ErrAPIKeyIPNotAllowed},
+		{name: "unknown address with allowlist", key: "office", wantErr: ErrAPIKeyIPNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := store.Authenticate(context.Background(), tt.key, net.ParseIP(tt.ip))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if claims.Username != tt.wantName || claims.UserID != "apikey:"+tt.wantName {
+				t.Errorf("got user %s (%s), want %s", claims.Username, claims.UserID, tt.wantName)
+			}
+			if claims.TokenType != TokenTypeAPIKey {
+				t.Errorf("token type = %s, want %s", claims.TokenType, TokenTypeAPIKey)
+			}
+		})
+	}
+
+	claims, err := store.Authenticate(context.Background(), "test", nil)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "editor" {
+		t.Errorf("roles = %v, want [editor]", claims.Roles)
+	}
+	if len(claims.Tables) != 1 || claims.Tables[0] != "invoice*" {
+		t.Errorf("tables = %v, want [invoice*]", claims.Tables)
+	}
+	if claims.TenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", claims.TenantID)
+	}
+}
+
+func TestNewAPIKeyStoreRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		key  config.APIKeyConfig
+	}{
+		{name: "invalid expiry", key: config.APIKeyConfig{Name: "a", Hash: HashAPIKey("a"), ExpiresAt: "tomorrow"}},
+		{name: "invalid address", key: config.APIKeyConfig{Name: "b", Hash: HashAPIKey("b"), AllowedIPs: []string{"10.0.0"}}},
+		{name: "invalid range", key: config.APIKeyConfig{Name: "c", Hash: HashAPIKey("c"), AllowedIPs: []string{"10.0.0.0/33"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAPIKeyStore(nil, &config.APIKeysConfig{Keys: []config.APIKeyConfig{tt.key}})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
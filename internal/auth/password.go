@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// VerifyPassword reports whether password matches hash. Hashes are bcrypt
+// ($2a$, $2b$, $2y$) or argon2id in PHC format
+// ($argon2id$v=19$m=65536,t=3,p=4$salt$hash).
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+// Upper bounds of the argon2id parameters accepted from stored hashes; memory
+// is in KiB
+const (
+	maxArgon2Memory = 1 << 20
+	maxArgon2Time   = 64
+)
+
+func verifyArgon2id(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnsupportedHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrUnsupportedHash
+	}
+	// argon2.IDKey panics on zero passes or threads, and a stored hash must
+	// not make a login allocate or compute without bound
+	if time == 0 || threads == 0 || time > maxArgon2Time || memory > maxArgon2Memory {
+		return false, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnsupportedHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	// An empty hash would match every password
+	if err != nil || len(expected) == 0 {
+		return false, ErrUnsupportedHash
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(actual, expected) == 1, nil
+}
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+)
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2idHash builds a PHC formatted argon2id hash of password
+func argon2idHash(password string, memory, time uint32, threads uint8) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	argonHash := argon2idHash("s3cret", 64, 1, 1)
+	salt := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  error
+	}{
+		{name: "bcrypt match", hash: string(bcryptHash), password: "s3cret", want: true},
+		{name: "bcrypt mismatch", hash: string(bcryptHash), password: "wrong"},
+		{name: "argon2id match", hash: argonHash, password: "s3cret", want: true},
+		{name: "argon2id mismatch", hash: argonHash, password: "wrong"},
+		{name: "plain text", hash: "s3cret", password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2i", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id wrong version", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id missing parts", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id zero passes", hash: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id zero threads", hash: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id too many passes", hash: "$argon2id$v=19$m=64,t=65,p=1$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id too much memory", hash: "$argon2id$v=19$m=1048577,t=1,p=1$" + salt + "$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id empty hash", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", password: "s3cret", wantErr: ErrUnsupportedHash},
+		{name: "argon2id invalid salt", hash: "$argon2id$v=19$m=64,t=1,p=1$!!$" + key, password: "s3cret", wantErr: ErrUnsupportedHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPassword(tt.hash, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if got {
+					t.Fatal("invalid hash verified")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyPassword: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
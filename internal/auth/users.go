@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/proyaai/instantgate/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account of the users table
+type User struct {
+	ID           string
+	Username     string
+	PasswordHash string
+	Roles        []string
+}
+
+// UserStore reads accounts from the configured users table
+type UserStore struct {
+	db  *sql.DB
+	cfg *config.AuthConfig
+	sb  sq.StatementBuilderType
+
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+func NewUserStore(db *sql.DB, cfg *config.AuthConfig) *UserStore {
+	return &UserStore{
+		db:  db,
+		cfg: cfg,
+		sb:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+}
+
+// Authenticate returns the user with the given credentials. Unknown users
+// still cost a hash comparison so response times do not reveal which
+// usernames exist.
+func (s *UserStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	user, err := s.FindByUsername(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(s.dummy(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := VerifyPassword(user.PasswordHash, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify password of user %s: %w", user.ID, err)
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) FindByUsername(ctx context.Context, username string) (*User, error) {
+	return s.find(ctx, s.cfg.UsernameColumn, username)
+}
+
+func (s *UserStore) FindByID(ctx context.Context, id string) (*User, error) {
+	return s.find(ctx, s.cfg.IDColumn, id)
+}
+
+func (s *UserStore) find(ctx context.Context, column, value string) (*User, error) {
+	columns := []string{
+		quoteIdentifier(s.cfg.IDColumn),
+		quoteIdentifier(s.cfg.UsernameColumn),
+		quoteIdentifier(s.cfg.PasswordColumn),
+	}
+	withRolesColumn := s.cfg.RolesTable == "" && s.cfg.RolesColumn != ""
+	if withRolesColumn {
+		columns = append(columns, quoteIdentifier(s.cfg.RolesColumn))
+	}
+
+	query, args, err := s.sb.
+		Select(columns...).
+		From(quoteIdentifier(s.cfg.UsersTable)).
+		Where(sq.Eq{quoteIdentifier(column): value}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var id, username, hash, roles sql.NullString
+	dest := []interface{}{&id, &username, &hash}
+	if withRolesColumn {
+		dest = append(dest, &roles)
+	}
+
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to query users table: %w", err)
+	}
+
+	user := &User{
+		ID:           id.String,
+		Username:     username.String,
+		PasswordHash: hash.String,
+	}
+
+	if withRolesColumn {
+		user.Roles = parseList(roles.String)
+	} else if s.cfg.RolesTable != "" {
+		if user.Roles, err = s.loadRoles(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// loadRoles reads the roles of a user from the roles join table
+func (s *UserStore) loadRoles(ctx context.Context, userID string) ([]string, error) {
+	query, args, err := s.sb.
+		Select(quoteIdentifier(s.cfg.RolesNameColumn)).
+		From(quoteIdentifier(s.cfg.RolesTable)).
+		Where(sq.Eq{quoteIdentifier(s.cfg.RolesUserColumn): userID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles table: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *UserStore) dummy() []byte {
+	s.dummyOnce.Do(func() {
+		s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("instantgate"), bcrypt.DefaultCost)
+	})
+	return s.dummyHash
+}
+
+// parseList reads a column holding a JSON array or a comma separated list
+func parseList(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(value, "[") {
+		var roles []string
+		if err := json.Unmarshal([]byte(value), &roles); err == nil {
+			return roles
+		}
+	}
+
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// quoteIdentifier wraps an identifier in backticks for MySQL
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
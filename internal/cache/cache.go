@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// Backend stores JSON encoded values with a lifetime. *Cache keeps them in
+// Redis, *MemoryCache in process and *TieredCache in both.
+type Backend interface {
+	Get(ctx context.Context, key string, dest interface{}) error
+	Set(ctx context.Context, key string, value interface{}) error
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Invalidate deletes the keys matching a glob pattern
+	Invalidate(ctx context.Context, pattern string) error
+	Exists(ctx context.Context, key string) bool
+	// Generations and BumpTags implement tag based invalidation, see tags.go
+	Generations(ctx context.Context, tags ...string) ([]int64, error)
+	BumpTags(ctx context.Context, tags ...string) error
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// NewBackend selects the backend configured by cfg. Redis is the connected
+// Redis cache or nil when Redis is not available; "auto" falls back to
+// memory without it. Closing a backend never closes redis.
+func NewBackend(cfg *config.CacheConfig, redis *Cache, ttl time.Duration) (Backend, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "auto":
+		if redis != nil {
+			return redis, nil
+		}
+		return NewMemoryCache(cfg.MaxBytes, ttl), nil
+
+	case "redis":
+		if redis == nil {
+			return nil, fmt.Errorf("cache backend redis requires a Redis connection")
+		}
+		return redis, nil
+
+	case "memory":
+		return NewMemoryCache(cfg.MaxBytes, ttl), nil
+
+	case "tiered":
+		if redis == nil {
+			slog.Warn("Redis unavailable, tiered cache runs in memory only")
+			return NewMemoryCache(cfg.MaxBytes, ttl), nil
+		}
+		return NewTieredCache(NewMemoryCache(cfg.MaxBytes, cfg.LocalTTL), redis, cfg.Channel)
+
+	default:
+		return nil, fmt.Errorf("invalid cache backend: %s", cfg.Backend)
+	}
+}
+
+// Status describes a backend for health reporting. The entry counts are
+// those of the memory cache or the memory tier.
+type Status struct {
+	Backend  string `json:"backend"`
+	Entries  int    `json:"entries,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+// Describe reports the kind and usage of b
+func Describe(b Backend) Status {
+	var local *MemoryCache
+	var status Status
+
+	switch b := b.(type) {
+	case *Cache:
+		status.Backend = "redis"
+	case *MemoryCache:
+		status.Backend = "memory"
+		local = b
+	case *TieredCache:
+		status.Backend = "tiered"
+		local = b.local
+	case nil:
+		status.Backend = "none"
+	default:
+		status.Backend = fmt.Sprintf("%T", b)
+	}
+
+	if local != nil {
+		status.Entries = local.Len()
+		status.Bytes = local.Size()
+		status.MaxBytes = local.maxBytes
+	}
+	return status
+}
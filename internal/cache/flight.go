@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+// Flight coalesces concurrent calls with the same key into one execution
+// whose result is shared by every caller. A nil *Flight runs each call on
+// its own.
+type Flight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func NewFlight() *Flight {
+	return &Flight{calls: make(map[string]*flightCall)}
+}
+
+// Do runs fn unless a call with key is already running, in which case it
+// waits for that call and returns its result. Shared reports whether the
+// result was produced by another caller.
+func (f *Flight) Do(key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	if f == nil {
+		value, err = fn()
+		return value, err, false
+	}
+
+	f.mu.Lock()
+	if call, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		<-call.done
+		return call.value, call.err, true
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(call.done)
+	}()
+
+	// Waiting callers see ErrFlightAborted if fn panics
+	call.err = ErrFlightAborted
+	call.value, call.err = fn()
+	return call.value, call.err, false
+}
+
+var (
+	ErrFlightAborted = errors.New("coalesced call aborted")
+)
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBytes limits a memory cache created without a size
+const DefaultMaxBytes = 64 << 20
+
+// MemoryCache is an in-process LRU cache with per-entry lifetimes. The size
+// of an entry is its key plus its JSON encoding; the least recently used
+// entries are evicted once maxBytes is exceeded.
+type MemoryCache struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+
+	// genMu serializes generation reads and bumps
+	genMu sync.Mutex
+}
+
+type memoryEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.data))
+}
+
+func NewMemoryCache(maxBytes int64, ttl time.Duration) *MemoryCache {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if ttl == 0 {
+		ttl = 5 * time.Minute
+	}
+
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string, dest interface{}) (err error) {
+	defer observeLookup("memory", &err)
+
+	data, ok := m.getRaw(key)
+	if !ok {
+		return ErrCacheMiss
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (m *MemoryCache) getRaw(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		m.remove(elem)
+		return nil, false
+	}
+
+	m.lru.MoveToFront(elem)
+	return entry.data, true
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}) error {
+	return m.SetWithTTL(ctx, key, value, m.ttl)
+}
+
+func (m *MemoryCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.setRaw(key, data, ttl)
+	return nil
+}
+
+func (m *MemoryCache) setRaw(key string, data []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = m.ttl
+	}
+	entry := &memoryEntry{key: key, data: data, expires: time.Now().Add(ttl)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+
+	// Entries larger than the whole cache are not stored
+	if entry.size() > m.maxBytes {
+		return
+	}
+
+	m.entries[key] = m.lru.PushFront(entry)
+	m.size += entry.size()
+
+	for m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+}
+
+// remove drops elem. Callers must hold m.mu.
+func (m *MemoryCache) remove(elem *list.Element) {
+	entry := m.lru.Remove(elem).(*memoryEntry)
+	delete(m.entries, entry.key)
+	m.size -= entry.size()
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := m.entries[key]; ok {
+			m.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) Invalidate(ctx context.Context, pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, elem := range m.entries {
+		if matched, err := path.Match(pattern, key); err == nil && matched {
+			m.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) Exists(ctx context.Context, key string) bool {
+	_, ok := m.getRaw(key)
+	return ok
+}
+
+// Generations returns the generation of each tag. Counters are regular
+// entries, so they may be evicted; like in Redis a missing counter restarts
+// at the current time and never repeats a value still used by cached keys.
+func (m *MemoryCache) Generations(ctx context.Context, tags ...string) ([]int64, error) {
+	m.genMu.Lock()
+	defer m.genMu.Unlock()
+
+	gens := make([]int64, len(tags))
+	for i, tag := range tags {
+		gens[i] = m.generation(generationKey(tag))
+	}
+	return gens, nil
+}
+
+func (m *MemoryCache) BumpTags(ctx context.Context, tags ...string) error {
+	m.genMu.Lock()
+	defer m.genMu.Unlock()
+
+	for _, tag := range tags {
+		key := generationKey(tag)
+		m.setRaw(key, strconv.AppendInt(nil, m.generation(key)+1, 10), 0)
+	}
+	return nil
+}
+
+// generation reads or starts the counter stored under key. Callers must
+// hold m.genMu.
+func (m *MemoryCache) generation(key string) int64 {
+	if data, ok := m.getRaw(key); ok {
+		if gen, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+			return gen
+		}
+	}
+
+	gen := time.Now().UnixNano()
+	m.setRaw(key, strconv.AppendInt(nil, gen, 10), 0)
+	return gen
+}
+
+func (m *MemoryCache) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lru.Init()
+	m.entries = make(map[string]*list.Element)
+	m.size = 0
+	return nil
+}
+
+// Size returns the number of bytes held by the cache
+func (m *MemoryCache) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
+
+// Len returns the number of entries held by the cache
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+func (m *MemoryCache) Close() error {
+	return nil
+}
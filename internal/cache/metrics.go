@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/proyaai/instantgate/internal/metrics"
+)
+
+// observeLookup counts a read of backend by its outcome. It is deferred
+// with a pointer to the named error result.
+func observeLookup(backend string, err *error) {
+	switch {
+	case *err == nil:
+		metrics.CacheLookups.Inc(backend, "hit")
+	case errors.Is(*err, ErrCacheMiss):
+		metrics.CacheLookups.Inc(backend, "miss")
+	default:
+		metrics.CacheLookups.Inc(backend, "error")
+	}
+}
+
+// observeError counts a failed operation of backend. It is deferred with a
+// pointer to the named error result.
+func observeError(backend, operation string, err *error) {
+	if *err != nil {
+		metrics.CacheErrors.Inc(backend, operation)
+	}
+}
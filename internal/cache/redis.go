@@ -24,6 +24,8 @@ func NewCache(cfg *config.RedisConfig) (*Cache, error) {
 		DB:       cfg.DB,
 	})
 
+	client.AddHook(traceHook{})
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -42,7 +44,9 @@ func NewCache(cfg *config.RedisConfig) (*Cache, error) {
 	}, nil
 }
 
-func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
+func (c *Cache) Get(ctx context.Context, key string, dest interface{}) (err error) {
+	defer observeLookup("redis", &err)
+
 	val, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -54,7 +58,9 @@ func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
 	return json.Unmarshal([]byte(val), dest)
 }
 
-func (c *Cache) Set(ctx context.Context, key string, value interface{}) error {
+func (c *Cache) Set(ctx context.Context, key string, value interface{}) (err error) {
+	defer observeError("redis", "set", &err)
+
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
@@ -63,7 +69,9 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}) error {
 	return c.client.Set(ctx, key, data, c.ttl).Err()
 }
 
-func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	defer observeError("redis", "set", &err)
+
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
@@ -72,14 +80,31 @@ func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, t
 	return c.client.Set(ctx, key, data, ttl).Err()
 }
 
-func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+// SetNX stores value under key unless the key exists and reports whether it
+// was stored
+func (c *Cache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (stored bool, err error) {
+	defer observeError("redis", "set", &err)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	return c.client.SetNX(ctx, key, data, ttl).Result()
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) (err error) {
+	defer observeError("redis", "delete", &err)
+
 	if len(keys) == 0 {
 		return nil
 	}
 	return c.client.Del(ctx, keys...).Err()
 }
 
-func (c *Cache) Invalidate(ctx context.Context, pattern string) error {
+func (c *Cache) Invalidate(ctx context.Context, pattern string) (err error) {
+	defer observeError("redis", "invalidate", &err)
+
 	iter := c.client.Scan(ctx, 0, pattern, 0).Iterator()
 	for iter.Next(ctx) {
 		if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
@@ -94,6 +119,17 @@ func (c *Cache) Exists(ctx context.Context, key string) bool {
 	return err == nil && n > 0
 }
 
+// Client returns the underlying Redis client for features that need more
+// than key/value access, such as atomic scripts
+func (c *Cache) Client() *redis.Client {
+	return c.client
+}
+
+// Ping checks that Redis is reachable
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
 func (c *Cache) Close() error {
 	return c.client.Close()
 }
@@ -103,11 +139,14 @@ func (c *Cache) Flush(ctx context.Context) error {
 }
 
 func GenerateQueryKey(table string, params interface{}) string {
-	h := sha256.New()
-	json.NewEncoder(h).Encode(params)
-	hash := hex.EncodeToString(h.Sum(nil))[:16]
+	return fmt.Sprintf("query:%s:%s", table, hashKey(params))
+}
 
-	return fmt.Sprintf("query:%s:%s", table, hash)
+// hashKey returns a short hash of the JSON encoding of v
+func hashKey(v interface{}) string {
+	h := sha256.New()
+	json.NewEncoder(h).Encode(v)
+	return hex.EncodeToString(h.Sum(nil))[:16]
 }
 
 func GenerateTableKey(table string) string {
@@ -118,9 +157,10 @@ func GenerateRecordKey(table, id string) string {
 	return fmt.Sprintf("record:%s:%s", table, id)
 }
 
+// InvalidateTable makes every cached response tagged with the table
+// unreachable
 func (c *Cache) InvalidateTable(ctx context.Context, table string) error {
-	pattern := fmt.Sprintf("*%s*", table)
-	return c.Invalidate(ctx, pattern)
+	return c.BumpTags(ctx, TableTag(table))
 }
 
 var (
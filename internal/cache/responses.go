@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// ResponseCache stores API responses of the tables opted in by the cache
+// config. A nil *ResponseCache caches nothing.
+type ResponseCache struct {
+	cache Backend
+	cfg   *config.CacheConfig
+	ttl   time.Duration
+}
+
+// CachedResponse is a JSON response body with the headers sent along with it
+type CachedResponse struct {
+	Body    json.RawMessage   `json:"body"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// FreshUntil is when the response expires; it may still be served
+	// while it is revalidated until the stale-while-revalidate window ends
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// Stale reports whether the response has expired and should be refreshed
+func (c *CachedResponse) Stale() bool {
+	return time.Now().After(c.FreshUntil)
+}
+
+// NewResponseCache returns nil when caching is disabled or no backend is
+// available. Ttl applies to tables without an override.
+func NewResponseCache(b Backend, cfg *config.CacheConfig, ttl time.Duration) *ResponseCache {
+	if b == nil || !cfg.Enabled {
+		return nil
+	}
+	if ttl == 0 {
+		ttl = 5 * time.Minute
+	}
+	return &ResponseCache{cache: b, cfg: cfg, ttl: ttl}
+}
+
+// Enabled reports whether responses of table are cached
+func (rc *ResponseCache) Enabled(table string) bool {
+	if rc == nil {
+		return false
+	}
+
+	table = strings.ToLower(table)
+	for _, pattern := range rc.cfg.Tables {
+		if matchPattern(pattern, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// TTL returns the lifetime of cached responses of table. An exact table
+// entry wins over patterns, and longer patterns over shorter ones.
+func (rc *ResponseCache) TTL(table string) time.Duration {
+	table = strings.ToLower(table)
+	if ttl, ok := rc.cfg.TTL[table]; ok {
+		return ttl
+	}
+
+	best, ttl := "", rc.ttl
+	for pattern, d := range rc.cfg.TTL {
+		if len(pattern) > len(best) && matchPattern(pattern, table) {
+			best, ttl = pattern, d
+		}
+	}
+	return ttl
+}
+
+// Key returns the key of a response of table. Variant holds everything the
+// response depends on besides the data, such as the query parameters and
+// the caller; tags name the data it was built from.
+func (rc *ResponseCache) Key(ctx context.Context, table string, tags []string, variant interface{}) (string, error) {
+	gens, err := rc.cache.Generations(ctx, tags...)
+	if err != nil {
+		return "", err
+	}
+
+	return GenerateQueryKey(strings.ToLower(table), struct {
+		Tags        []string    `json:"t"`
+		Generations []int64     `json:"g"`
+		Variant     interface{} `json:"v"`
+	}{tags, gens, variant}), nil
+}
+
+// Get returns the cached response stored under key or ErrCacheMiss
+func (rc *ResponseCache) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	var resp CachedResponse
+	if err := rc.cache.Get(ctx, key, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Set stores resp under key for the TTL of table plus the
+// stale-while-revalidate window
+func (rc *ResponseCache) Set(ctx context.Context, table, key string, resp *CachedResponse) error {
+	ttl := rc.TTL(table)
+	resp.FreshUntil = time.Now().Add(ttl)
+	return rc.cache.SetWithTTL(ctx, key, resp, ttl+rc.cfg.StaleWhileRevalidate)
+}
+
+// Invalidate makes the responses built from any of tags unreachable
+func (rc *ResponseCache) Invalidate(ctx context.Context, tags ...string) error {
+	if rc == nil {
+		return nil
+	}
+	return rc.cache.BumpTags(ctx, tags...)
+}
+
+func matchPattern(pattern, table string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), table)
+	return err == nil && matched
+}
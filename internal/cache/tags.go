@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cached responses are invalidated through generation counters instead of
+// deleting keys. Every response key embeds the current generation of its
+// tags; bumping a tag makes all keys built with the previous generation
+// unreachable in O(1), and the stale entries expire with their TTL.
+
+// TableTag covers every response that lists rows of table
+func TableTag(table string) string {
+	return GenerateTableKey(strings.ToLower(table))
+}
+
+// RecordTag covers the responses of a single record
+func RecordTag(table, id string) string {
+	return GenerateRecordKey(strings.ToLower(table), id)
+}
+
+// RelatedTag covers the records of table that change when a table they
+// reference is written, e.g. through cascading foreign keys or embedded rows
+func RelatedTag(table string) string {
+	return "related:" + strings.ToLower(table)
+}
+
+func generationKey(tag string) string {
+	return "gen:" + tag
+}
+
+// Generations returns the current generation of each tag. Missing counters
+// start at the current time so a counter lost to eviction never returns to
+// a value used by keys that are still cached.
+func (c *Cache) Generations(ctx context.Context, tags ...string) (_ []int64, err error) {
+	defer observeError("redis", "generations", &err)
+
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = generationKey(tag)
+	}
+
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make([]int64, len(tags))
+	var missing []int
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		if gens[i], err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(missing) > 0 {
+		pipe := c.client.Pipeline()
+		cmds := make([]*redis.StringCmd, len(missing))
+		start := time.Now().UnixNano()
+		for j, i := range missing {
+			pipe.SetNX(ctx, keys[i], start, 0)
+			cmds[j] = pipe.Get(ctx, keys[i])
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		for j, i := range missing {
+			if gens[i], err = cmds[j].Int64(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return gens, nil
+}
+
+// BumpTags advances the generation of each tag in a single round trip
+func (c *Cache) BumpTags(ctx context.Context, tags ...string) (err error) {
+	defer observeError("redis", "bump_tags", &err)
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	start := time.Now().UnixNano()
+	for _, tag := range tags {
+		key := generationKey(tag)
+		pipe.SetNX(ctx, key, start, 0)
+		pipe.Incr(ctx, key)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
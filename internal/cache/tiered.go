@@ -0,0 +1,333 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// TieredCache keeps a local LRU in front of Redis. Values are written to
+// both tiers and read locally first. Every change is published on a Redis
+// channel so other instances drop their local copies.
+type TieredCache struct {
+	local   *MemoryCache
+	redis   *Cache
+	channel string
+	// source identifies this instance in published messages
+	source string
+
+	genMu sync.Mutex
+	gens  map[string]localGeneration
+	// forgotten records when each tag's counter was last dropped and flushed
+	// when all were, so a read of Redis that started earlier does not store
+	// the value it read from before the bump
+	forgotten map[string]time.Time
+	flushed   time.Time
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+// maxLocalGenerations bounds the generation counters kept locally before
+// expired ones are dropped
+const maxLocalGenerations = 10000
+
+// localGeneration is a generation counter read from Redis. It is trusted for
+// the local TTL, which bounds staleness when invalidation messages are lost.
+type localGeneration struct {
+	value   int64
+	fetched time.Time
+}
+
+// invalidation is the message published on the channel
+type invalidation struct {
+	Source  string   `json:"source"`
+	Keys    []string `json:"keys,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Flush   bool     `json:"flush,omitempty"`
+}
+
+// NewTieredCache subscribes to channel and starts applying invalidations
+// of other instances to local
+func NewTieredCache(local *MemoryCache, remote *Cache, channel string) (*TieredCache, error) {
+	if channel == "" {
+		channel = "instantgate:cache"
+	}
+
+	t := &TieredCache{
+		local:     local,
+		redis:     remote,
+		channel:   channel,
+		source:    uuid.New().String(),
+		gens:      make(map[string]localGeneration),
+		forgotten: make(map[string]time.Time),
+		done:      make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.pubsub = remote.client.Subscribe(ctx, channel)
+	if _, err := t.pubsub.Receive(ctx); err != nil {
+		t.pubsub.Close()
+		return nil, err
+	}
+
+	go t.listen()
+
+	return t, nil
+}
+
+func (t *TieredCache) listen() {
+	defer close(t.done)
+
+	for msg := range t.pubsub.Channel() {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			slog.Warn("Invalid cache invalidation message", "error", err)
+			continue
+		}
+		if inv.Source != t.source {
+			t.apply(&inv)
+		}
+	}
+}
+
+// apply drops the local state covered by inv
+func (t *TieredCache) apply(inv *invalidation) {
+	ctx := context.Background()
+
+	if inv.Flush {
+		t.local.Flush(ctx)
+		t.forgetGenerations()
+		return
+	}
+
+	if len(inv.Keys) > 0 {
+		t.local.Delete(ctx, inv.Keys...)
+	}
+	if inv.Pattern != "" {
+		t.local.Invalidate(ctx, inv.Pattern)
+	}
+	if len(inv.Tags) > 0 {
+		t.forgetGenerations(inv.Tags...)
+	}
+}
+
+func (t *TieredCache) publish(ctx context.Context, inv invalidation) {
+	inv.Source = t.source
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return
+	}
+	if err := t.redis.client.Publish(ctx, t.channel, data).Err(); err != nil {
+		slog.WarnContext(ctx, "Cache invalidation not published", "error", err)
+	}
+}
+
+func (t *TieredCache) Get(ctx context.Context, key string, dest interface{}) (err error) {
+	defer observeLookup("tiered", &err)
+
+	if data, ok := t.local.getRaw(key); ok {
+		return json.Unmarshal(data, dest)
+	}
+
+	pipe := t.redis.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrCacheMiss
+		}
+		return err
+	}
+
+	data, err := get.Bytes()
+	if err != nil {
+		return err
+	}
+
+	t.local.setRaw(key, data, t.localTTL(ttl.Val()))
+	return json.Unmarshal(data, dest)
+}
+
+// localTTL caps ttl, the remaining lifetime in Redis, at the local TTL
+func (t *TieredCache) localTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > t.local.ttl {
+		return t.local.ttl
+	}
+	return ttl
+}
+
+func (t *TieredCache) Set(ctx context.Context, key string, value interface{}) error {
+	return t.SetWithTTL(ctx, key, value, t.redis.ttl)
+}
+
+func (t *TieredCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	defer observeError("tiered", "set", &err)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if err := t.redis.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return err
+	}
+
+	t.local.setRaw(key, data, t.localTTL(ttl))
+	t.publish(ctx, invalidation{Keys: []string{key}})
+	return nil
+}
+
+func (t *TieredCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	t.local.Delete(ctx, keys...)
+	if err := t.redis.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidation{Keys: keys})
+	return nil
+}
+
+func (t *TieredCache) Invalidate(ctx context.Context, pattern string) error {
+	t.local.Invalidate(ctx, pattern)
+	if err := t.redis.Invalidate(ctx, pattern); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidation{Pattern: pattern})
+	return nil
+}
+
+func (t *TieredCache) Exists(ctx context.Context, key string) bool {
+	if _, ok := t.local.getRaw(key); ok {
+		return true
+	}
+	return t.redis.Exists(ctx, key)
+}
+
+// Generations answers from the generations read from Redis within the local
+// TTL and reads the others in one round trip
+func (t *TieredCache) Generations(ctx context.Context, tags ...string) ([]int64, error) {
+	gens := make([]int64, len(tags))
+	var missing []string
+	var missingIdx []int
+
+	now := time.Now()
+	t.genMu.Lock()
+	for i, tag := range tags {
+		gen, ok := t.gens[tag]
+		if ok && now.Sub(gen.fetched) < t.local.ttl {
+			gens[i] = gen.value
+			continue
+		}
+		missing = append(missing, tag)
+		missingIdx = append(missingIdx, i)
+	}
+	t.genMu.Unlock()
+
+	if len(missing) == 0 {
+		return gens, nil
+	}
+
+	fetched, err := t.redis.Generations(ctx, missing...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.genMu.Lock()
+	defer t.genMu.Unlock()
+	for j, i := range missingIdx {
+		gens[i] = fetched[j]
+		// The counter may have been bumped since it was read; the value
+		// is used for this call but not kept
+		tag := missing[j]
+		if !now.After(t.flushed) || !now.After(t.forgotten[tag]) {
+			continue
+		}
+		t.gens[tag] = localGeneration{value: fetched[j], fetched: now}
+	}
+
+	// Drop expired counters so record tags do not accumulate. Reads that
+	// started before an expired entry was recorded would only store values
+	// that are expired as well.
+	if len(t.gens) > maxLocalGenerations {
+		for tag, gen := range t.gens {
+			if now.Sub(gen.fetched) >= t.local.ttl {
+				delete(t.gens, tag)
+			}
+		}
+	}
+	if len(t.forgotten) > maxLocalGenerations {
+		for tag, at := range t.forgotten {
+			if now.Sub(at) >= t.local.ttl {
+				delete(t.forgotten, tag)
+			}
+		}
+	}
+
+	return gens, nil
+}
+
+func (t *TieredCache) BumpTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	err := t.redis.BumpTags(ctx, tags...)
+	// Forget after the bump: reads that started before are not stored by
+	// Generations, reads that start afterwards see the new value
+	t.forgetGenerations(tags...)
+	if err != nil {
+		return err
+	}
+	t.publish(ctx, invalidation{Tags: tags})
+	return nil
+}
+
+// forgetGenerations drops the local counters of tags, or all counters when
+// no tags are given, and records when they were dropped
+func (t *TieredCache) forgetGenerations(tags ...string) {
+	t.genMu.Lock()
+	defer t.genMu.Unlock()
+
+	now := time.Now()
+	if len(tags) == 0 {
+		t.gens = make(map[string]localGeneration)
+		t.forgotten = make(map[string]time.Time)
+		t.flushed = now
+		return
+	}
+	for _, tag := range tags {
+		delete(t.gens, tag)
+		t.forgotten[tag] = now
+	}
+}
+
+func (t *TieredCache) Flush(ctx context.Context) error {
+	t.local.Flush(ctx)
+	t.forgetGenerations()
+	if err := t.redis.Flush(ctx); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidation{Flush: true})
+	return nil
+}
+
+// Close stops listening for invalidations. The Redis client is left open
+// for its owner.
+func (t *TieredCache) Close() error {
+	err := t.pubsub.Close()
+	<-t.done
+	return err
+}
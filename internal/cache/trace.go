@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/proyaai/instantgate/internal/tracing"
+	"github.com/redis/go-redis/v9"
+)
+
+// traceHook creates a client span for every Redis command and pipeline run
+// within a traced request. Arguments are not recorded as they hold cached
+// values and keys derived from callers.
+type traceHook struct{}
+
+func (traceHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (traceHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracing.Start(ctx, "redis "+cmd.Name(), tracing.KindClient)
+		if span == nil {
+			return next(ctx, cmd)
+		}
+		defer span.End()
+
+		span.SetAttr("db.system", "redis")
+		span.SetAttr("db.operation", cmd.Name())
+
+		err := next(ctx, cmd)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			span.SetError(err)
+		}
+		return err
+	}
+}
+
+func (traceHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracing.Start(ctx, "redis pipeline", tracing.KindClient)
+		if span == nil {
+			return next(ctx, cmds)
+		}
+		defer span.End()
+
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		span.SetAttr("db.system", "redis")
+		span.SetAttr("db.operation", strings.Join(names, " "))
+		span.SetAttr("db.redis.commands", len(cmds))
+
+		err := next(ctx, cmds)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			span.SetError(err)
+		}
+		return err
+	}
+}
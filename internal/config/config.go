@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -12,10 +14,30 @@ type Config struct {
 	Server     ServerConfig     `mapstructure:"server"`
 	Database   DatabaseConfig   `mapstructure:"database"`
 	JWT        JWTConfig        `mapstructure:"jwt"`
+	Auth       AuthConfig       `mapstructure:"auth"`
 	Redis      RedisConfig      `mapstructure:"redis"`
 	Security   SecurityConfig   `mapstructure:"security"`
 	Validation ValidationConfig `mapstructure:"validation"`
 	Logging    LoggingConfig    `mapstructure:"logging"`
+	Tenancy    TenancyConfig    `mapstructure:"tenancy"`
+	RateLimit  RateLimitConfig  `mapstructure:"rate_limit"`
+	CORS       CORSConfig       `mapstructure:"cors"`
+	Headers    HeadersConfig    `mapstructure:"security_headers"`
+	Audit      AuditConfig      `mapstructure:"audit"`
+	Cache      CacheConfig      `mapstructure:"cache"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
+	Tracing    TracingConfig    `mapstructure:"tracing"`
+	QueryStats QueryStatsConfig `mapstructure:"query_stats"`
+	Health     HealthConfig     `mapstructure:"health"`
+
+	// path is the config file the configuration was read from
+	path string
+}
+
+// Path returns the config file the configuration was read from, or an empty
+// string when only defaults and environment variables were used
+func (c *Config) Path() string {
+	return c.path
 }
 
 type ServerConfig struct {
@@ -23,6 +45,82 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// TrustedProxies are the IPs or CIDRs of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers name the client
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// TrustedProxyNets parses TrustedProxies; single IPs become host networks
+func (s *ServerConfig) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, entry := range s.TrustedProxies {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// CORSConfig is the global CORS policy with optional overrides per path prefix
+type CORSConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	CORSPolicy `mapstructure:",squash"`
+	// Routes overrides the policy for path prefixes such as "/auth". Empty
+	// lists and max_age are inherited from the global policy.
+	Routes map[string]CORSPolicy `mapstructure:"routes"`
+}
+
+type CORSPolicy struct {
+	// AllowedOrigins may contain "*" or one wildcard per origin, e.g.
+	// "https://*.example.com"
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+// Inherit fills the unset fields of a route policy from the global one
+func (p CORSPolicy) Inherit(global CORSPolicy) CORSPolicy {
+	if len(p.AllowedOrigins) == 0 {
+		p.AllowedOrigins = global.AllowedOrigins
+	}
+	if len(p.AllowedMethods) == 0 {
+		p.AllowedMethods = global.AllowedMethods
+	}
+	if len(p.AllowedHeaders) == 0 {
+		p.AllowedHeaders = global.AllowedHeaders
+	}
+	if len(p.ExposedHeaders) == 0 {
+		p.ExposedHeaders = global.ExposedHeaders
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = global.MaxAge
+	}
+	return p
+}
+
+// HeadersConfig sets security response headers; empty values are omitted
+type HeadersConfig struct {
+	Enabled               bool          `mapstructure:"enabled"`
+	HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"`
+	HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	ContentTypeOptions    string        `mapstructure:"content_type_options"`
+	FrameOptions          string        `mapstructure:"frame_options"`
+	ContentSecurityPolicy string        `mapstructure:"content_security_policy"`
+	ReferrerPolicy        string        `mapstructure:"referrer_policy"`
 }
 
 type DatabaseConfig struct {
@@ -46,6 +144,62 @@ type JWTConfig struct {
 	Secret string        `mapstructure:"secret"`
 	Expiry time.Duration `mapstructure:"expiry"`
 	Issuer string        `mapstructure:"issuer"`
+	// Algorithms accepted when verifying tokens, e.g. HS256, RS256, ES256, EdDSA
+	Algorithms []string `mapstructure:"algorithms"`
+	// PublicKeys are PEM files holding RSA, ECDSA or Ed25519 public keys
+	PublicKeys []string `mapstructure:"public_keys"`
+	// JWKSURL is fetched on startup, when the cache expires and on unknown key IDs
+	JWKSURL string `mapstructure:"jwks_url"`
+	// JWKSFile is a local JWKS document for offline verification
+	JWKSFile     string        `mapstructure:"jwks_file"`
+	JWKSCacheTTL time.Duration `mapstructure:"jwks_cache_ttl"`
+	// Issuers accepted in addition to Issuer
+	Issuers  []string      `mapstructure:"issuers"`
+	Audience []string      `mapstructure:"audience"`
+	Leeway   time.Duration `mapstructure:"leeway"`
+	// RefreshExpiry is the lifetime of refresh tokens issued at login
+	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"`
+	// ClaimMapping locates identity fields in tokens of external providers
+	ClaimMapping ClaimMappingConfig `mapstructure:"claim_mapping"`
+}
+
+// ClaimMappingConfig maps identity fields to claim paths. Paths are claim
+// names or dotted paths into nested objects, e.g. "realm_access.roles" or
+// "https://example.com/roles". Empty fields keep the standard claims.
+type ClaimMappingConfig struct {
+	UserID   string `mapstructure:"user_id"`
+	Username string `mapstructure:"username"`
+	// Roles are merged from every listed path
+	Roles  []string `mapstructure:"roles"`
+	Tenant string   `mapstructure:"tenant"`
+}
+
+// UsesHMAC reports whether HMAC signed tokens are accepted
+func (j *JWTConfig) UsesHMAC() bool {
+	for _, alg := range j.Algorithms {
+		if strings.HasPrefix(strings.ToUpper(alg), "HS") {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthConfig enables the built-in login endpoints, which verify credentials
+// against a users table and issue access and refresh tokens
+type AuthConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	UsersTable     string `mapstructure:"users_table"`
+	IDColumn       string `mapstructure:"id_column"`
+	UsernameColumn string `mapstructure:"username_column"`
+	// PasswordColumn holds bcrypt or argon2id password hashes
+	PasswordColumn string `mapstructure:"password_column"`
+	// RolesColumn holds a comma separated list or JSON array of roles
+	RolesColumn string `mapstructure:"roles_column"`
+	// RolesTable is a join table used instead of RolesColumn, with one row
+	// per user and role
+	RolesTable      string `mapstructure:"roles_table"`
+	RolesUserColumn string `mapstructure:"roles_user_column"`
+	RolesNameColumn string `mapstructure:"roles_name_column"`
 }
 
 type RedisConfig struct {
@@ -61,34 +215,251 @@ func (r *RedisConfig) Address() string {
 }
 
 type SecurityConfig struct {
-	Enabled    bool     `mapstructure:"enabled"`
-	Whitelist  []string `mapstructure:"whitelist"`
-	Blacklist  []string `mapstructure:"blacklist"`
-	RequireAuth bool    `mapstructure:"require_auth"`
+	Enabled bool `mapstructure:"enabled"`
+	// Whitelist and Blacklist hold case-insensitive table names, globs such
+	// as "audit_*", regexes such as "/^tmp_[0-9]+$/" and exclusions with a
+	// leading "!", e.g. "!*_secret"
+	Whitelist   []string                      `mapstructure:"whitelist"`
+	Blacklist   []string                      `mapstructure:"blacklist"`
+	RequireAuth bool                          `mapstructure:"require_auth"`
+	Columns     map[string]ColumnPolicyConfig `mapstructure:"columns"`
+	// MaskSecret keys the HMAC of columns masked with "hash"
+	MaskSecret string `mapstructure:"mask_secret"`
+	// Roles maps a role name to table patterns and the operations
+	// (read, create, update, delete or *) allowed on them
+	Roles       map[string]map[string][]string `mapstructure:"roles"`
+	RowPolicies map[string]RowPolicyConfig     `mapstructure:"row_policies"`
+	// AdminRoles may use the administrative endpoints, e.g. token revocation
+	AdminRoles []string      `mapstructure:"admin_roles"`
+	APIKeys    APIKeysConfig `mapstructure:"api_keys"`
+	// ACLFile stores whitelist, blacklist and role changes made through the
+	// admin API. When the file exists it overrides the lists of this config.
+	// A relative path is resolved against the directory of the config file;
+	// empty disables changes through the admin API.
+	ACLFile string `mapstructure:"acl_file"`
+	// WatchACL reloads the access lists when the config or ACL file changes
+	WatchACL bool `mapstructure:"watch_acl"`
 }
 
-func (s *SecurityConfig) IsTableAllowed(table string) bool {
-	for _, blocked := range s.Blacklist {
-		if strings.EqualFold(blocked, table) {
-			return false
-		}
-	}
+// APIKeysConfig enables authentication with API keys sent in the X-API-Key
+// header or as "Authorization: ApiKey <key>". Keys are stored as hex encoded
+// SHA-256 hashes, in the config file or in a database table.
+type APIKeysConfig struct {
+	Enabled bool           `mapstructure:"enabled"`
+	Keys    []APIKeyConfig `mapstructure:"keys"`
+	// Table stores additional keys, one row per key
+	Table            string `mapstructure:"table"`
+	HashColumn       string `mapstructure:"hash_column"`
+	NameColumn       string `mapstructure:"name_column"`
+	RolesColumn      string `mapstructure:"roles_column"`
+	TablesColumn     string `mapstructure:"tables_column"`
+	ExpiresColumn    string `mapstructure:"expires_column"`
+	AllowedIPsColumn string `mapstructure:"allowed_ips_column"`
+	// TenantColumn binds keys of the table to a tenant (empty = no column)
+	TenantColumn string `mapstructure:"tenant_column"`
+}
 
-	if len(s.Whitelist) == 0 {
-		return true
-	}
+type APIKeyConfig struct {
+	Name string `mapstructure:"name"`
+	Hash string `mapstructure:"hash"`
+	// Roles are evaluated like JWT roles by all access policies
+	Roles []string `mapstructure:"roles"`
+	// Tables restricts the key to these table patterns (empty = no restriction)
+	Tables []string `mapstructure:"tables"`
+	// ExpiresAt is an RFC 3339 timestamp, empty for keys that never expire
+	ExpiresAt string `mapstructure:"expires_at"`
+	// AllowedIPs lists client IPs or CIDR ranges (empty = any address)
+	AllowedIPs []string `mapstructure:"allowed_ips"`
+	// Tenant is the only tenant the key may access when tenancy is enabled
+	Tenant string `mapstructure:"tenant"`
+}
 
-	for _, allowed := range s.Whitelist {
-		if strings.EqualFold(allowed, table) {
-			return true
-		}
-	}
+// RowPolicyConfig restricts the rows of a table a caller can see and modify.
+// Each filter has the form "column = claims.<name>", e.g. "user_id = claims.uid".
+type RowPolicyConfig struct {
+	Filters     []string `mapstructure:"filters"`
+	BypassRoles []string `mapstructure:"bypass_roles"`
+	// OnInsert is "force" (default) to overwrite the column with the claim
+	// value, or "reject" to refuse writes carrying a different value
+	OnInsert string `mapstructure:"on_insert"`
+}
 
-	return false
+// ColumnPolicyConfig describes which columns of a table are hidden from
+// reads and which are protected from writes.
+type ColumnPolicyConfig struct {
+	Hidden    []string `mapstructure:"hidden"`
+	ReadOnly  []string `mapstructure:"read_only"`
+	WriteOnce []string `mapstructure:"write_once"`
+	// OnWrite is "reject" (default) or "ignore" for writes to protected columns
+	OnWrite string `mapstructure:"on_write"`
+	// Read configures per-role visibility and masking by column name
+	Read map[string]ColumnReadConfig `mapstructure:"read"`
+}
+
+// ColumnReadConfig decides per role whether a column is returned in full,
+// masked, or not at all.
+type ColumnReadConfig struct {
+	// Mask is the masking strategy: redact (default), partial, hash or null
+	Mask   string   `mapstructure:"mask"`
+	Full   []string `mapstructure:"full"`
+	Masked []string `mapstructure:"masked"`
+	// Default applies to roles not listed above: masked (default), full or none
+	Default string `mapstructure:"default"`
+}
+
+// AuditConfig records creates, updates and deletes of the listed tables
+type AuditConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Sink is "database" (written in the same transaction), "file" (JSON
+	// lines) or "stdout"
+	Sink  string `mapstructure:"sink"`
+	Table string `mapstructure:"table"`
+	File  string `mapstructure:"file"`
+	// Tables are the audited table patterns, e.g. ["orders", "user_*"] or ["*"]
+	Tables []string `mapstructure:"tables"`
+	// Exclude maps a table (or "*") to columns left out of audit entries
+	Exclude map[string][]string `mapstructure:"exclude"`
+}
+
+// CacheConfig caches list and get responses of the listed tables.
+// Writes through the API invalidate the cached responses of the table.
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Tables are the cached table patterns, e.g. ["products", "ref_*"]
+	Tables []string `mapstructure:"tables"`
+	// TTL overrides redis.cache_ttl per table pattern
+	TTL map[string]time.Duration `mapstructure:"ttl"`
+	// Backend is "auto" (Redis when connected, memory otherwise), "redis",
+	// "memory" or "tiered" (memory in front of Redis)
+	Backend string `mapstructure:"backend"`
+	// MaxBytes limits the in-memory cache
+	MaxBytes int64 `mapstructure:"max_bytes"`
+	// LocalTTL caps how long the memory tier of "tiered" serves entries
+	// without asking Redis
+	LocalTTL time.Duration `mapstructure:"local_ttl"`
+	// Channel is the Redis pub/sub channel "tiered" instances use to drop
+	// each other's local copies
+	Channel string `mapstructure:"channel"`
+	// Coalesce shares one database query between concurrent identical list
+	// and get requests, also for tables that are not cached
+	Coalesce bool `mapstructure:"coalesce"`
+	// StaleWhileRevalidate serves expired responses for this long while one
+	// request refreshes them in the background
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate"`
 }
 
+// MetricsConfig exposes Prometheus metrics. The metrics name tables and
+// their traffic, so set Token or restrict the endpoint at the network level.
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	// Token is the bearer token scrapers have to send; empty allows anyone
+	Token string `mapstructure:"token"`
+}
+
+// TracingConfig exports request, SQL and Redis spans. Incoming W3C
+// traceparent headers continue the caller's trace.
+type TracingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is "otlp" (OTLP/HTTP with JSON encoding), "file" or "stdout";
+	// file and stdout write OTLP JSON lines
+	Exporter string            `mapstructure:"exporter"`
+	Endpoint string            `mapstructure:"endpoint"`
+	Headers  map[string]string `mapstructure:"headers"`
+	File     string            `mapstructure:"file"`
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string `mapstructure:"service_name"`
+	// SampleRatio is the share of traces recorded, from 0 to 1
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	// TrustRemoteSampling keeps the sampling decision of an incoming
+	// traceparent header instead of applying SampleRatio. Enable it only
+	// when clients cannot set the header, e.g. behind a gateway that
+	// starts the traces.
+	TrustRemoteSampling bool `mapstructure:"trust_remote_sampling"`
+}
+
+// QueryStatsConfig configures the slow query log and the rolling statistics
+// of the statements run for API requests
+type QueryStatsConfig struct {
+	// SlowThreshold logs statements taking longer; 0 disables the log
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// Enabled keeps statistics per table and statement shape for the
+	// admin endpoint
+	Enabled bool `mapstructure:"enabled"`
+	// Window is the period statistics are computed over
+	Window time.Duration `mapstructure:"window"`
+	// MaxShapes bounds the tracked shapes; the least recently seen are dropped
+	MaxShapes int `mapstructure:"max_shapes"`
+	// MaxSamples bounds the durations kept per shape
+	MaxSamples int `mapstructure:"max_samples"`
+}
+
+// HealthConfig configures the liveness and readiness probes
+type HealthConfig struct {
+	// Timeout bounds each dependency check of a probe, so a hung dependency
+	// fails its check instead of hanging the probe
+	Timeout time.Duration `mapstructure:"timeout"`
+	// DrainDelay is how long the readiness probe fails on shutdown before
+	// the server stops accepting connections, giving load balancers time to
+	// take the instance out of rotation
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// RequireRedis makes readiness depend on Redis even when neither the
+	// cache nor the rate limits use it
+	RequireRedis bool `mapstructure:"require_redis"`
+}
+
+// RateLimitConfig configures token bucket limits. Every caller is limited
+// by its identity (user, API key or client IP); table limits apply on top.
+type RateLimitConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Default RateLimitRule `mapstructure:"default"`
+	// Roles override the default; the most generous rule of the caller's roles wins
+	Roles map[string]RateLimitRule `mapstructure:"roles"`
+	// Identities override roles for a user ID or API key name
+	Identities map[string]RateLimitRule `mapstructure:"identities"`
+	// Tables maps a table to per-operation limits (read, create, update,
+	// delete or *), counted per caller
+	Tables map[string]map[string]RateLimitRule `mapstructure:"tables"`
+}
+
+// RateLimitRule allows Requests per Period with bursts of up to Burst
+// requests (default Requests). Rules without requests are unlimited.
+type RateLimitRule struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+// TenancyConfig enables serving many tenants from one instance
+type TenancyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Mode is "column" (shared tables filtered by a tenant column) or
+	// "schema" (one database per tenant)
+	Mode string `mapstructure:"mode"`
+	// Source is where the tenant is read from: claim, header or subdomain
+	Source     string `mapstructure:"source"`
+	Claim      string `mapstructure:"claim"`
+	Header     string `mapstructure:"header"`
+	BaseDomain string `mapstructure:"base_domain"`
+	// Column is the tenant column filtered and set in column mode
+	Column string `mapstructure:"column"`
+	// DatabaseTemplate names the tenant database in schema mode, {tenant} is replaced
+	DatabaseTemplate string `mapstructure:"database_template"`
+	// SharedSchema reuses the introspected schema for every tenant database
+	SharedSchema bool `mapstructure:"shared_schema"`
+	// MaxDatabases bounds the tenant connection pools open in schema mode;
+	// the least recently used is closed to make room
+	MaxDatabases int `mapstructure:"max_databases"`
+	// FailureTTL is how long a tenant database that could not be connected
+	// fails requests before it is tried again
+	FailureTTL time.Duration `mapstructure:"failure_ttl"`
+}
+
+// LoggingConfig configures the structured logger used by every package
 type LoggingConfig struct {
-	Level  string `mapstructure:"level"`
+	// Level is debug, info, warn or error
+	Level string `mapstructure:"level"`
+	// Format is json or text
 	Format string `mapstructure:"format"`
 }
 
@@ -137,6 +508,11 @@ func Load(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	cfg.path = v.ConfigFileUsed()
+	if cfg.path != "" && cfg.Security.ACLFile != "" && !filepath.IsAbs(cfg.Security.ACLFile) {
+		cfg.Security.ACLFile = filepath.Join(filepath.Dir(cfg.path), cfg.Security.ACLFile)
+	}
+
 	return &cfg, nil
 }
 
@@ -145,6 +521,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
 
+	if _, err := c.Server.TrustedProxyNets(); err != nil {
+		return err
+	}
+
 	if c.Database.Host == "" {
 		return fmt.Errorf("database host is required")
 	}
@@ -153,9 +533,240 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database name is required")
 	}
 
-	if c.JWT.Secret == "" {
+	if c.JWT.Secret == "" && c.JWT.UsesHMAC() {
 		return fmt.Errorf("JWT secret is required")
 	}
 
+	for _, alg := range c.JWT.Algorithms {
+		switch strings.ToUpper(alg) {
+		case "HS256", "HS384", "HS512", "RS256", "RS384", "RS512",
+			"PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EDDSA":
+		default:
+			return fmt.Errorf("unsupported JWT algorithm: %s", alg)
+		}
+	}
+
+	if c.Auth.Enabled {
+		if !c.JWT.UsesHMAC() {
+			return fmt.Errorf("built-in login requires an HMAC JWT algorithm")
+		}
+		if c.Auth.UsersTable == "" || c.Auth.UsernameColumn == "" || c.Auth.PasswordColumn == "" {
+			return fmt.Errorf("auth users_table, username_column and password_column are required")
+		}
+		if c.Auth.RolesTable != "" && (c.Auth.RolesUserColumn == "" || c.Auth.RolesNameColumn == "") {
+			return fmt.Errorf("auth roles_user_column and roles_name_column are required with roles_table")
+		}
+	}
+
+	for _, key := range c.Security.APIKeys.Keys {
+		if key.Name == "" || key.Hash == "" {
+			return fmt.Errorf("API keys require a name and a hash")
+		}
+		if key.ExpiresAt != "" {
+			if _, err := time.Parse(time.RFC3339, key.ExpiresAt); err != nil {
+				return fmt.Errorf("invalid expires_at for API key %s: %w", key.Name, err)
+			}
+		}
+	}
+
+	if c.Audit.Enabled {
+		switch c.Audit.Sink {
+		case "database":
+			if c.Audit.Table == "" {
+				return fmt.Errorf("audit table is required for the database sink")
+			}
+		case "file":
+			if c.Audit.File == "" {
+				return fmt.Errorf("audit file is required for the file sink")
+			}
+		case "stdout":
+		default:
+			return fmt.Errorf("invalid audit sink: %s", c.Audit.Sink)
+		}
+	}
+
+	if c.CORS.Enabled {
+		// Route policies are checked as applied, with the origins they
+		// inherit
+		policies := []CORSPolicy{c.CORS.CORSPolicy}
+		for _, policy := range c.CORS.Routes {
+			policies = append(policies, policy.Inherit(c.CORS.CORSPolicy))
+		}
+		for _, policy := range policies {
+			if !policy.AllowCredentials {
+				continue
+			}
+			for _, origin := range policy.AllowedOrigins {
+				if origin == "*" {
+					return fmt.Errorf("CORS allow_credentials cannot be used with the \"*\" origin")
+				}
+			}
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		rules := []RateLimitRule{c.RateLimit.Default}
+		for _, rule := range c.RateLimit.Roles {
+			rules = append(rules, rule)
+		}
+		for _, rule := range c.RateLimit.Identities {
+			rules = append(rules, rule)
+		}
+		for table, ops := range c.RateLimit.Tables {
+			for op, rule := range ops {
+				switch strings.ToLower(op) {
+				case "*", "read", "create", "update", "delete":
+				default:
+					return fmt.Errorf("invalid rate limit operation %q on table %s", op, table)
+				}
+				rules = append(rules, rule)
+			}
+		}
+		for _, rule := range rules {
+			if rule.Requests > 0 && rule.Period <= 0 {
+				return fmt.Errorf("rate limit period must be positive")
+			}
+		}
+	}
+
+	if c.Tenancy.Enabled {
+		switch c.Tenancy.Mode {
+		case "column":
+			if c.Tenancy.Column == "" {
+				return fmt.Errorf("tenancy column is required in column mode")
+			}
+		case "schema":
+			if !strings.Contains(c.Tenancy.DatabaseTemplate, "{tenant}") {
+				return fmt.Errorf("tenancy database_template must contain {tenant}")
+			}
+			if c.Tenancy.MaxDatabases <= 0 {
+				return fmt.Errorf("tenancy max_databases must be positive")
+			}
+			if c.Tenancy.FailureTTL < 0 {
+				return fmt.Errorf("tenancy failure_ttl must not be negative")
+			}
+		default:
+			return fmt.Errorf("invalid tenancy mode: %s", c.Tenancy.Mode)
+		}
+
+		switch c.Tenancy.Source {
+		case "claim", "header":
+		case "subdomain":
+			if c.Tenancy.BaseDomain == "" {
+				return fmt.Errorf("tenancy base_domain is required for subdomain source")
+			}
+		default:
+			return fmt.Errorf("invalid tenancy source: %s", c.Tenancy.Source)
+		}
+	}
+
+	if c.QueryStats.SlowThreshold < 0 {
+		return fmt.Errorf("query_stats slow_threshold must not be negative")
+	}
+	if c.QueryStats.Enabled && (c.QueryStats.Window <= 0 || c.QueryStats.MaxShapes <= 0 || c.QueryStats.MaxSamples <= 0) {
+		return fmt.Errorf("query_stats window, max_shapes and max_samples must be positive")
+	}
+
+	if c.Health.Timeout <= 0 {
+		return fmt.Errorf("health timeout must be positive")
+	}
+	if c.Health.DrainDelay < 0 {
+		return fmt.Errorf("health drain_delay must not be negative")
+	}
+
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("invalid log level: %s", c.Logging.Level)
+	}
+
+	switch strings.ToLower(c.Logging.Format) {
+	case "", "json", "text":
+	default:
+		return fmt.Errorf("invalid log format: %s", c.Logging.Format)
+	}
+
+	switch strings.ToLower(c.Cache.Backend) {
+	case "", "auto", "redis", "memory", "tiered":
+	default:
+		return fmt.Errorf("invalid cache backend: %s", c.Cache.Backend)
+	}
+
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		return fmt.Errorf("metrics path must start with /: %s", c.Metrics.Path)
+	}
+
+	if c.Tracing.Enabled {
+		switch strings.ToLower(c.Tracing.Exporter) {
+		case "", "otlp":
+			if c.Tracing.Endpoint == "" {
+				return fmt.Errorf("tracing endpoint is required for the otlp exporter")
+			}
+		case "file":
+			if c.Tracing.File == "" {
+				return fmt.Errorf("tracing file is required for the file exporter")
+			}
+		case "stdout":
+		default:
+			return fmt.Errorf("invalid tracing exporter: %s", c.Tracing.Exporter)
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+		}
+	}
+
+	if err := ValidateRoles(c.Security.Roles); err != nil {
+		return err
+	}
+
+	for table, policy := range c.Security.RowPolicies {
+		switch strings.ToLower(policy.OnInsert) {
+		case "", "force", "reject":
+		default:
+			return fmt.Errorf("invalid on_insert mode for table %s: %s", table, policy.OnInsert)
+		}
+	}
+
+	for table, policy := range c.Security.Columns {
+		switch strings.ToLower(policy.OnWrite) {
+		case "", "reject", "ignore":
+		default:
+			return fmt.Errorf("invalid on_write mode for table %s: %s", table, policy.OnWrite)
+		}
+
+		for column, read := range policy.Read {
+			switch strings.ToLower(read.Mask) {
+			case "", "redact", "partial", "null":
+			case "hash":
+				if c.Security.MaskSecret == "" {
+					return fmt.Errorf("security mask_secret is required to hash column %s.%s", table, column)
+				}
+			default:
+				return fmt.Errorf("invalid mask for column %s.%s: %s", table, column, read.Mask)
+			}
+			switch strings.ToLower(read.Default) {
+			case "", "masked", "full", "none":
+			default:
+				return fmt.Errorf("invalid default read access for column %s.%s: %s", table, column, read.Default)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateRoles checks the operations of role permissions
+func ValidateRoles(roles map[string]map[string][]string) error {
+	for role, tables := range roles {
+		for table, ops := range tables {
+			for _, op := range ops {
+				switch strings.ToLower(op) {
+				case "*", "read", "create", "update", "delete":
+				default:
+					return fmt.Errorf("invalid operation %q for role %s on table %s", op, role, table)
+				}
+			}
+		}
+	}
 	return nil
 }
@@ -11,6 +11,7 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.read_timeout", 30*time.Second)
 	v.SetDefault("server.write_timeout", 30*time.Second)
 	v.SetDefault("server.idle_timeout", 60*time.Second)
+	v.SetDefault("server.trusted_proxies", []string{})
 
 	v.SetDefault("database.driver", "mysql")
 	v.SetDefault("database.host", "localhost")
@@ -25,6 +26,29 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("jwt.secret", "change-me-in-production")
 	v.SetDefault("jwt.expiry", 24*time.Hour)
 	v.SetDefault("jwt.issuer", "instantgate")
+	v.SetDefault("jwt.algorithms", []string{"HS256"})
+	v.SetDefault("jwt.public_keys", []string{})
+	v.SetDefault("jwt.jwks_url", "")
+	v.SetDefault("jwt.jwks_file", "")
+	v.SetDefault("jwt.jwks_cache_ttl", time.Hour)
+	v.SetDefault("jwt.issuers", []string{})
+	v.SetDefault("jwt.audience", []string{})
+	v.SetDefault("jwt.leeway", 30*time.Second)
+	v.SetDefault("jwt.claim_mapping.user_id", "")
+	v.SetDefault("jwt.claim_mapping.username", "")
+	v.SetDefault("jwt.claim_mapping.roles", []string{})
+	v.SetDefault("jwt.claim_mapping.tenant", "")
+	v.SetDefault("jwt.refresh_expiry", 7*24*time.Hour)
+
+	v.SetDefault("auth.enabled", false)
+	v.SetDefault("auth.users_table", "users")
+	v.SetDefault("auth.id_column", "id")
+	v.SetDefault("auth.username_column", "username")
+	v.SetDefault("auth.password_column", "password_hash")
+	v.SetDefault("auth.roles_column", "roles")
+	v.SetDefault("auth.roles_table", "")
+	v.SetDefault("auth.roles_user_column", "user_id")
+	v.SetDefault("auth.roles_name_column", "role")
 
 	v.SetDefault("redis.host", "localhost")
 	v.SetDefault("redis.port", 6379)
@@ -36,10 +60,102 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("security.require_auth", false)
 	v.SetDefault("security.whitelist", []string{})
 	v.SetDefault("security.blacklist", []string{})
+	v.SetDefault("security.columns", map[string]interface{}{})
+	v.SetDefault("security.mask_secret", "")
+	v.SetDefault("security.roles", map[string]interface{}{})
+	v.SetDefault("security.row_policies", map[string]interface{}{})
+	v.SetDefault("security.admin_roles", []string{"admin"})
+	v.SetDefault("security.acl_file", "acl.yaml")
+	v.SetDefault("security.watch_acl", true)
+	v.SetDefault("security.api_keys.enabled", false)
+	v.SetDefault("security.api_keys.table", "")
+	v.SetDefault("security.api_keys.hash_column", "key_hash")
+	v.SetDefault("security.api_keys.name_column", "name")
+	v.SetDefault("security.api_keys.roles_column", "roles")
+	v.SetDefault("security.api_keys.tables_column", "tables")
+	v.SetDefault("security.api_keys.expires_column", "expires_at")
+	v.SetDefault("security.api_keys.allowed_ips_column", "allowed_ips")
+	v.SetDefault("security.api_keys.tenant_column", "")
 
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
 
+	v.SetDefault("tenancy.enabled", false)
+	v.SetDefault("tenancy.mode", "column")
+	v.SetDefault("tenancy.source", "claim")
+	v.SetDefault("tenancy.claim", "tenant_id")
+	v.SetDefault("tenancy.header", "X-Tenant-ID")
+	v.SetDefault("tenancy.column", "tenant_id")
+	v.SetDefault("tenancy.database_template", "{tenant}")
+	v.SetDefault("tenancy.shared_schema", true)
+	v.SetDefault("tenancy.max_databases", 100)
+	v.SetDefault("tenancy.failure_ttl", 10*time.Second)
+
+	v.SetDefault("audit.enabled", false)
+	v.SetDefault("audit.sink", "database")
+	v.SetDefault("audit.table", "audit_log")
+	v.SetDefault("audit.file", "audit.jsonl")
+	v.SetDefault("audit.tables", []string{})
+	v.SetDefault("audit.exclude", map[string]interface{}{})
+
+	v.SetDefault("cache.enabled", false)
+	v.SetDefault("cache.tables", []string{})
+	v.SetDefault("cache.ttl", map[string]interface{}{})
+	v.SetDefault("cache.backend", "auto")
+	v.SetDefault("cache.max_bytes", 64<<20)
+	v.SetDefault("cache.local_ttl", 30*time.Second)
+	v.SetDefault("cache.channel", "instantgate:cache")
+	v.SetDefault("cache.coalesce", true)
+	v.SetDefault("cache.stale_while_revalidate", time.Duration(0))
+
+	v.SetDefault("metrics.enabled", false)
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("metrics.token", "")
+
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.exporter", "otlp")
+	v.SetDefault("tracing.endpoint", "http://localhost:4318/v1/traces")
+	v.SetDefault("tracing.headers", map[string]string{})
+	v.SetDefault("tracing.file", "traces.jsonl")
+	v.SetDefault("tracing.service_name", "instantgate")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("tracing.trust_remote_sampling", false)
+
+	v.SetDefault("query_stats.slow_threshold", 500*time.Millisecond)
+	v.SetDefault("query_stats.enabled", true)
+	v.SetDefault("query_stats.window", 15*time.Minute)
+	v.SetDefault("query_stats.max_shapes", 1000)
+	v.SetDefault("query_stats.max_samples", 1000)
+
+	v.SetDefault("health.timeout", 2*time.Second)
+	v.SetDefault("health.drain_delay", time.Duration(0))
+	v.SetDefault("health.require_redis", false)
+
+	v.SetDefault("cors.enabled", true)
+	v.SetDefault("cors.allowed_origins", []string{"*"})
+	v.SetDefault("cors.allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	v.SetDefault("cors.allowed_headers", []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key", "traceparent"})
+	v.SetDefault("cors.exposed_headers", []string{"X-Total-Count", "X-Limit", "X-Offset", "X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", "X-Cache", "X-Trace-ID"})
+	v.SetDefault("cors.allow_credentials", false)
+	v.SetDefault("cors.max_age", 5*time.Minute)
+	v.SetDefault("cors.routes", map[string]interface{}{})
+
+	v.SetDefault("security_headers.enabled", true)
+	v.SetDefault("security_headers.hsts_max_age", time.Duration(0))
+	v.SetDefault("security_headers.hsts_include_subdomains", false)
+	v.SetDefault("security_headers.content_type_options", "nosniff")
+	v.SetDefault("security_headers.frame_options", "DENY")
+	v.SetDefault("security_headers.content_security_policy", "default-src 'none'; frame-ancestors 'none'")
+	v.SetDefault("security_headers.referrer_policy", "no-referrer")
+
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.default.requests", 100)
+	v.SetDefault("rate_limit.default.period", time.Minute)
+	v.SetDefault("rate_limit.default.burst", 0)
+	v.SetDefault("rate_limit.roles", map[string]interface{}{})
+	v.SetDefault("rate_limit.identities", map[string]interface{}{})
+	v.SetDefault("rate_limit.tables", map[string]interface{}{})
+
 	v.SetDefault("validation.enabled", true)
 	v.SetDefault("validation.strict_mode", false)
 	v.SetDefault("validation.rules", map[string]interface{}{})
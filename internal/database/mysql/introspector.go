@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/proyaai/instantgate/internal/config"
 	"github.com/proyaai/instantgate/internal/database"
+	"github.com/proyaai/instantgate/internal/metrics"
 )
 
 type Introspector struct {
@@ -52,19 +54,27 @@ func (i *Introspector) LoadSchema(ctx context.Context) (*SchemaCache, error) {
 
 	tables, err := driver.GetTables(ctx, db)
 	if err != nil {
+		metrics.SchemaReloads.Inc("error")
 		return nil, fmt.Errorf("failed to load schema: %w", err)
 	}
 
+	start := time.Now()
 	i.cache = NewSchemaCache()
 
 	for _, table := range tables {
 		tableSchema, err := i.loadTableSchema(ctx, db, driver, table)
 		if err != nil {
+			metrics.SchemaReloads.Inc("error")
 			return nil, fmt.Errorf("failed to load schema for table %s: %w", table, err)
 		}
 		i.cache.Set(table, tableSchema)
 	}
 
+	i.cache.setLoaded(start, time.Since(start))
+
+	metrics.SchemaReloads.Inc("success")
+	metrics.SchemaLastReload.Set(float64(time.Now().Unix()))
+
 	return i.cache, nil
 }
 
@@ -121,6 +131,9 @@ func (i *Introspector) ReloadSchema(ctx context.Context) (*SchemaCache, error) {
 type SchemaCache struct {
 	tables map[string]*TableSchema
 	mu     sync.RWMutex
+
+	loadedAt     time.Time
+	loadDuration time.Duration
 }
 
 func NewSchemaCache() *SchemaCache {
@@ -172,6 +185,45 @@ func (sc *SchemaCache) TableExists(table string) bool {
 	return ok
 }
 
+// Len returns the number of tables
+func (sc *SchemaCache) Len() int {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return len(sc.tables)
+}
+
+// LoadedAt returns when the schema was loaded from the database and how long
+// loading took; the time is zero for a cache not filled by LoadSchema
+func (sc *SchemaCache) LoadedAt() (time.Time, time.Duration) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.loadedAt, sc.loadDuration
+}
+
+func (sc *SchemaCache) setLoaded(at time.Time, d time.Duration) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.loadedAt = at
+	sc.loadDuration = d
+}
+
+// ReferencedBy returns the tables with a foreign key to table
+func (sc *SchemaCache) ReferencedBy(table string) []string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	var tables []string
+	for name, schema := range sc.tables {
+		for _, rel := range schema.Relationships {
+			if strings.EqualFold(rel.ReferencedTable, table) {
+				tables = append(tables, name)
+				break
+			}
+		}
+	}
+	return tables
+}
+
 type TableSchema struct {
 	Name          string
 	Columns       map[string]ColumnInfo
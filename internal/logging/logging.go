@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/security"
+	"github.com/proyaai/instantgate/internal/tracing"
+)
+
+// Setup makes the logger configured by cfg the slog and log default, so
+// packages log through slog.Default and its package functions
+func Setup(cfg *config.LoggingConfig) (*slog.Logger, error) {
+	logger, err := New(cfg, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// New creates a logger writing to w in the configured format and level.
+// Records logged with a request context carry the request ID, trace ID,
+// user ID, tenant, table and operation of the request.
+func New(cfg *config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", cfg.Format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level: %s", level)
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx whose log records carry id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestFields carries attributes known only deeper in the handler chain,
+// such as the authenticated user and the tenant, back to records logged with
+// an outer context like the access log line
+type requestFields struct {
+	mu     sync.Mutex
+	user   string
+	tenant string
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx whose records carry the user and tenant
+// later set with SetClaims and SetTenant on contexts derived from it
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &requestFields{})
+}
+
+// SetClaims records the authenticated user of the request
+func SetClaims(ctx context.Context, claims *security.Claims) {
+	if f, ok := ctx.Value(fieldsKey{}).(*requestFields); ok {
+		f.mu.Lock()
+		f.user = userID(claims)
+		f.mu.Unlock()
+	}
+}
+
+// SetTenant records the tenant of the request
+func SetTenant(ctx context.Context, id string) {
+	if f, ok := ctx.Value(fieldsKey{}).(*requestFields); ok {
+		f.mu.Lock()
+		f.tenant = id
+		f.mu.Unlock()
+	}
+}
+
+// contextHandler adds the request attributes found in the context of a
+// record. They are read when the record is logged, so attributes known only
+// later in the request, such as the user after authentication, are included.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		record.AddAttrs(requestAttrs(ctx)...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func requestAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	if sc := tracing.SpanFromContext(ctx).Context(); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID.String()), slog.String("span_id", sc.SpanID.String()))
+	}
+
+	var user, tenant string
+	if f, ok := ctx.Value(fieldsKey{}).(*requestFields); ok {
+		f.mu.Lock()
+		user, tenant = f.user, f.tenant
+		f.mu.Unlock()
+	}
+	if claims, ok := security.ClaimsFromContext(ctx); ok {
+		user = userID(claims)
+	}
+	if user != "" {
+		attrs = append(attrs, slog.String("user_id", user))
+	}
+	if tenant != "" {
+		attrs = append(attrs, slog.String("tenant", tenant))
+	}
+
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if table := rctx.URLParam("table"); table != "" {
+			attrs = append(attrs, slog.String("table", table))
+			if op := operation(rctx.RouteMethod); op != "" {
+				attrs = append(attrs, slog.String("operation", op))
+			}
+		}
+	}
+
+	return attrs
+}
+
+func userID(claims *security.Claims) string {
+	if claims.UserID != "" {
+		return claims.UserID
+	}
+	return claims.Subject
+}
+
+// operation names the CRUD operation of a method on a table route
+func operation(method string) string {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD":
+		return string(security.OperationRead)
+	case "POST":
+		return string(security.OperationCreate)
+	case "PUT", "PATCH":
+		return string(security.OperationUpdate)
+	case "DELETE":
+		return string(security.OperationDelete)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Metrics of InstantGate, registered in Default
+var (
+	HTTPRequests = Default.NewCounter("instantgate_http_requests_total",
+		"HTTP requests by route template, table, operation and status.",
+		"method", "route", "table", "operation", "status")
+	HTTPDuration = Default.NewHistogram("instantgate_http_request_duration_seconds",
+		"HTTP request latency by route template, table, operation and status.",
+		DefaultBuckets, "method", "route", "table", "operation", "status")
+
+	QueryDuration = Default.NewHistogram("instantgate_db_query_duration_seconds",
+		"Duration of SQL statements by table and statement kind.",
+		DefaultBuckets, "table", "statement")
+	QueryErrors = Default.NewCounter("instantgate_db_query_errors_total",
+		"Failed SQL statements by table and statement kind.",
+		"table", "statement")
+
+	CacheLookups = Default.NewCounter("instantgate_cache_lookups_total",
+		"Cache reads by backend and result (hit, miss or error).",
+		"backend", "result")
+	CacheErrors = Default.NewCounter("instantgate_cache_errors_total",
+		"Failed cache operations by backend and operation.",
+		"backend", "operation")
+
+	ValidationFailures = Default.NewCounter("instantgate_validation_failures_total",
+		"Rejected fields of create and update requests by table and error code.",
+		"table", "code")
+
+	SchemaReloads = Default.NewCounter("instantgate_schema_reloads_total",
+		"Schema introspections by result (success or error).",
+		"result")
+	SchemaLastReload = Default.NewGauge("instantgate_schema_last_reload_timestamp_seconds",
+		"Unix time of the last successful schema introspection.")
+)
+
+// Since returns the seconds elapsed since start
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// DBStats reports the connection pool statistics of db at scrape time
+func DBStats(db *sql.DB) func() []Family {
+	return func() []Family {
+		stats := db.Stats()
+		return []Family{
+			{
+				Name:    "instantgate_db_connections_max_open",
+				Help:    "Maximum number of open connections to the database.",
+				Type:    "gauge",
+				Samples: []Sample{{Value: float64(stats.MaxOpenConnections)}},
+			},
+			{
+				Name: "instantgate_db_connections",
+				Help: "Established connections by state.",
+				Type: "gauge",
+				Samples: []Sample{
+					{Labels: []string{"state", "in_use"}, Value: float64(stats.InUse)},
+					{Labels: []string{"state", "idle"}, Value: float64(stats.Idle)},
+				},
+			},
+			{
+				Name:    "instantgate_db_wait_count_total",
+				Help:    "Connections waited for because the pool was exhausted.",
+				Type:    "counter",
+				Samples: []Sample{{Value: float64(stats.WaitCount)}},
+			},
+			{
+				Name:    "instantgate_db_wait_duration_seconds_total",
+				Help:    "Time spent waiting for a connection.",
+				Type:    "counter",
+				Samples: []Sample{{Value: stats.WaitDuration.Seconds()}},
+			},
+			{
+				Name: "instantgate_db_connections_closed_total",
+				Help: "Connections closed by the pool by reason.",
+				Type: "counter",
+				Samples: []Sample{
+					{Labels: []string{"reason", "max_idle"}, Value: float64(stats.MaxIdleClosed)},
+					{Labels: []string{"reason", "max_idle_time"}, Value: float64(stats.MaxIdleTimeClosed)},
+					{Labels: []string{"reason", "max_lifetime"}, Value: float64(stats.MaxLifetimeClosed)},
+				},
+			},
+		}
+	}
+}
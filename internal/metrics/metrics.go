@@ -0,0 +1,379 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds from 5ms to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format. Metrics are registered once; series are created on first use.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]family
+	// funcs compute families at scrape time, keyed by their owner
+	funcs map[string]func() []Family
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// Family is a metric computed at scrape time
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // counter or gauge
+	Samples []Sample
+}
+
+// Sample is one series of a Family. Labels alternate names and values.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]family),
+		funcs:    make(map[string]func() []Family),
+	}
+}
+
+// Default is the registry served on /metrics
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.families[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.families[name] = f
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which must
+// be sorted, and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(name, h)
+	return h
+}
+
+// SetFunc registers fn under key to report families at scrape time,
+// replacing an earlier fn of the same key. A nil fn removes it.
+func (r *Registry) SetFunc(key string, fn func() []Family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fn == nil {
+		delete(r.funcs, key)
+		return
+	}
+	r.funcs[key] = fn
+}
+
+// Write renders every metric sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	all := make(map[string]family, len(r.families))
+	for name, f := range r.families {
+		all[name] = f
+	}
+	funcs := make([]func() []Family, 0, len(r.funcs))
+	for _, fn := range r.funcs {
+		funcs = append(funcs, fn)
+	}
+	r.mu.RUnlock()
+
+	for _, fn := range funcs {
+		for _, f := range fn() {
+			f := f
+			all[f.Name] = &f
+		}
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		all[name].write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry in the text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// vec is a set of series of a counter or gauge keyed by label values
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*sample
+}
+
+type sample struct {
+	values []string
+	value  float64
+}
+
+func newVec(name, help, typ string, labels []string) vec {
+	return vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*sample)}
+}
+
+// get returns the series of values. Callers must hold v.mu.
+func (v *vec) get(values []string) *sample {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &sample{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	samples := make([]sample, 0, len(v.series))
+	for _, s := range v.series {
+		samples = append(samples, *s)
+	}
+	v.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return lessValues(samples[i].values, samples[j].values)
+	})
+
+	writeHeader(w, v.name, v.help, v.typ)
+	for _, s := range samples {
+		writeSample(w, v.name, v.labels, s.values, "", "", s.value)
+	}
+}
+
+// Counter is a monotonically increasing value per label set
+type Counter struct {
+	vec
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the series
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	c.get(values).value += delta
+	c.mu.Unlock()
+}
+
+// Gauge is a value per label set that can go up and down
+type Gauge struct {
+	vec
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value = value
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value += delta
+	g.mu.Unlock()
+}
+
+// Histogram counts observations in cumulative buckets per label set
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe records value in the series of the label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(values)))
+	}
+
+	i := sort.SearchFloat64s(h.buckets, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(values, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			values: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	s.counts[i]++
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	series := make([]histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		copied := *s
+		copied.counts = append([]uint64(nil), s.counts...)
+		series = append(series, copied)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return lessValues(series[i].values, series[j].values)
+	})
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, s := range series {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", "", float64(s.count))
+	}
+}
+
+func (f *Family) write(w *bufio.Writer) {
+	writeHeader(w, f.Name, f.Help, f.Type)
+	for _, s := range f.Samples {
+		names := make([]string, 0, len(s.Labels)/2)
+		values := make([]string, 0, len(s.Labels)/2)
+		for i := 0; i+1 < len(s.Labels); i += 2 {
+			names = append(names, s.Labels[i])
+			values = append(values, s.Labels[i+1])
+		}
+		writeSample(w, f.Name, names, values, "", "", s.Value)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSample writes one line; extraName adds a label such as le
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label, values[i])
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(labelEscaper.Replace(value))
+	w.WriteByte('"')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func lessValues(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
@@ -1,25 +1,224 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/security"
 )
 
 type Builder struct {
-	sb     sq.StatementBuilderType
-	schema *mysql.SchemaCache
+	sb      sq.StatementBuilderType
+	schema  *mysql.SchemaCache
+	columns *security.ColumnPolicies
+	rows    *security.RowPolicies
+	claims  *security.Claims
+
+	tenantColumn string
+	tenantID     string
+	// allColumns reads columns regardless of column policies
+	allColumns bool
 }
 
-func NewBuilder(schema *mysql.SchemaCache) *Builder {
+func NewBuilder(schema *mysql.SchemaCache, columns *security.ColumnPolicies, rows *security.RowPolicies) *Builder {
 	return &Builder{
-		sb:     sq.StatementBuilder.PlaceholderFormat(sq.Question),
-		schema: schema,
+		sb:      sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		schema:  schema,
+		columns: columns,
+		rows:    rows,
 	}
 }
 
+// ForClaims returns a builder that applies row policies for the given caller.
+// A nil claims value is treated as an anonymous caller.
+func (b *Builder) ForClaims(claims *security.Claims) *Builder {
+	scoped := *b
+	scoped.claims = claims
+	return &scoped
+}
+
+// WithSchema returns a builder that resolves tables against schema
+func (b *Builder) WithSchema(schema *mysql.SchemaCache) *Builder {
+	scoped := *b
+	scoped.schema = schema
+	return &scoped
+}
+
+// ForTenant returns a builder that restricts every table having column to
+// rows of the given tenant and sets the column on insert
+func (b *Builder) ForTenant(column, id string) *Builder {
+	scoped := *b
+	scoped.tenantColumn = column
+	scoped.tenantID = id
+	return &scoped
+}
+
+// AllColumns returns a builder that reads every column regardless of the
+// caller's column access, e.g. for audit images. Row policies and the tenant
+// still apply.
+func (b *Builder) AllColumns() *Builder {
+	scoped := *b
+	scoped.allColumns = true
+	return &scoped
+}
+
+// scopeConditions returns the row policy and tenant conditions for table
+func (b *Builder) scopeConditions(tableSchema *mysql.TableSchema) ([]security.RowCondition, error) {
+	conditions, err := b.rows.Conditions(tableSchema.Name, b.claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.tenantColumn == "" {
+		return conditions, nil
+	}
+	if _, ok := tableSchema.Columns[strings.ToLower(b.tenantColumn)]; !ok {
+		return conditions, nil
+	}
+	if b.tenantID == "" {
+		return nil, fmt.Errorf("%w: tenant", security.ErrMissingClaim)
+	}
+
+	return append(conditions, security.RowCondition{Column: b.tenantColumn, Value: b.tenantID}), nil
+}
+
+// rowConditions returns the row policy and tenant conditions for the bound
+// caller. When a claim required by the policy is missing, every row is
+// filtered out.
+func (b *Builder) rowConditions(tableSchema *mysql.TableSchema) ([]sq.Sqlizer, error) {
+	conditions, err := b.scopeConditions(tableSchema)
+	if errors.Is(err, security.ErrMissingClaim) {
+		return []sq.Sqlizer{sq.Expr("1 = 0")}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]sq.Sqlizer, 0, len(conditions))
+	for _, cond := range conditions {
+		col, ok := tableSchema.Columns[strings.ToLower(cond.Column)]
+		if !ok {
+			return nil, fmt.Errorf("row policy column '%s' not found in table '%s'", cond.Column, tableSchema.Name)
+		}
+		result = append(result, sq.Eq{escapeIdentifier(col.Name): coerceValue(col, cond.Value)})
+	}
+	return result, nil
+}
+
+// ApplyRowPolicy fills in or checks the row policy columns of data for table,
+// so callers can validate the data that will actually be written
+func (b *Builder) ApplyRowPolicy(table string, data map[string]interface{}, insert bool) (map[string]interface{}, error) {
+	tableSchema, exists := b.schema.Get(table)
+	if !exists {
+		return nil, fmt.Errorf("table '%s' not found", table)
+	}
+	return b.applyRowValues(tableSchema, data, insert)
+}
+
+// applyRowValues enforces row policy and tenant values on written data. On
+// insert the policy columns are always set; on update they are only checked
+// when present.
+func (b *Builder) applyRowValues(tableSchema *mysql.TableSchema, data map[string]interface{}, insert bool) (map[string]interface{}, error) {
+	conditions, err := b.scopeConditions(tableSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(conditions) == 0 {
+		return data, nil
+	}
+
+	reject := b.rows.RejectsWrites(tableSchema.Name)
+	result := make(map[string]interface{}, len(data)+len(conditions))
+	for col, val := range data {
+		result[col] = val
+	}
+
+	for _, cond := range conditions {
+		col, ok := tableSchema.Columns[strings.ToLower(cond.Column)]
+		if !ok {
+			return nil, fmt.Errorf("row policy column '%s' not found in table '%s'", cond.Column, tableSchema.Name)
+		}
+
+		present := false
+		for key, val := range result {
+			if !strings.EqualFold(key, col.Name) {
+				continue
+			}
+			present = true
+			if reject && fmt.Sprint(val) != fmt.Sprint(coerceValue(col, cond.Value)) {
+				return nil, fmt.Errorf("%w: column '%s' must match the caller", security.ErrRowPolicyViolation, col.Name)
+			}
+			delete(result, key)
+		}
+
+		if present || insert {
+			result[col.Name] = coerceValue(col, cond.Value)
+		}
+	}
+
+	return result, nil
+}
+
+// readLevel returns how much of column the bound caller may see
+func (b *Builder) readLevel(tableSchema *mysql.TableSchema, column string) security.ReadLevel {
+	if b.allColumns {
+		return security.ReadFull
+	}
+	return b.columns.ReadAccess(tableSchema.Name, column, security.CallerRoles(b.claims))
+}
+
+// lookupColumn returns the schema column for name, treating columns the
+// caller cannot see as if they did not exist
+func (b *Builder) lookupColumn(tableSchema *mysql.TableSchema, name string) (mysql.ColumnInfo, bool) {
+	col, ok := tableSchema.Columns[strings.ToLower(name)]
+	if !ok || b.readLevel(tableSchema, col.Name) == security.ReadNone {
+		return mysql.ColumnInfo{}, false
+	}
+	return col, true
+}
+
+// lookupFilterColumn resolves a column used for filtering or sorting. Masked
+// columns are rejected so their values cannot be probed through the query.
+func (b *Builder) lookupFilterColumn(tableSchema *mysql.TableSchema, name string) error {
+	col, ok := b.lookupColumn(tableSchema, name)
+	if !ok {
+		return fmt.Errorf("unknown column '%s' in table '%s'", name, tableSchema.Name)
+	}
+	if b.readLevel(tableSchema, col.Name) != security.ReadFull {
+		return fmt.Errorf("column '%s' cannot be used for filtering or sorting", name)
+	}
+	return nil
+}
+
+// selectColumns resolves the requested fields, or every visible column when
+// no fields were requested
+func (b *Builder) selectColumns(tableSchema *mysql.TableSchema, fields []string) ([]string, error) {
+	var columns []string
+	if len(fields) > 0 {
+		for _, field := range fields {
+			if _, ok := b.lookupColumn(tableSchema, field); !ok {
+				return nil, fmt.Errorf("unknown column '%s' in table '%s'", field, tableSchema.Name)
+			}
+			columns = append(columns, escapeIdentifier(field))
+		}
+		return columns, nil
+	}
+
+	// Use original column names from schema (not the lowercase keys)
+	for _, col := range tableSchema.Columns {
+		if b.readLevel(tableSchema, col.Name) == security.ReadNone {
+			continue
+		}
+		columns = append(columns, escapeIdentifier(col.Name))
+	}
+	return columns, nil
+}
+
 // escapeIdentifier wraps an identifier in backticks for MySQL
 func escapeIdentifier(name string) string {
 	return fmt.Sprintf("`%s`", strings.ReplaceAll(name, "`", "``"))
@@ -34,42 +233,85 @@ func escapeIdentifierSlice(names []string) []string {
 	return result
 }
 
+// coerceValue converts a claim value to the Go type of col where possible,
+// so numeric key columns receive numbers rather than strings
+func coerceValue(col mysql.ColumnInfo, value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	switch col.GoType {
+	case "int64":
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return i
+		}
+	case "float64":
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// KeyString returns the canonical form of a primary key value of
+// tableSchema, coerced like query arguments, so that "01", "1" and 1 name
+// the same record
+func KeyString(tableSchema *mysql.TableSchema, value interface{}) string {
+	col, ok := tableSchema.Columns[tableSchema.PrimaryKey]
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	switch v := coerceValue(col, value).(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		// JSON numbers of integer keys are decoded as float64
+		if col.GoType == "int64" && v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func (b *Builder) BuildSelect(table string, params *QueryParams) (string, []interface{}, error) {
 	tableSchema, exists := b.schema.Get(table)
 	if !exists {
 		return "", nil, fmt.Errorf("table '%s' not found", table)
 	}
 
-	var columns []string
-	if len(params.Fields) > 0 {
-		for _, field := range params.Fields {
-			if _, ok := tableSchema.Columns[strings.ToLower(field)]; !ok {
-				return "", nil, fmt.Errorf("unknown column '%s' in table '%s'", field, table)
-			}
-			columns = append(columns, escapeIdentifier(field))
-		}
-	} else {
-		// Use original column names from schema (not the lowercase keys)
-		for _, col := range tableSchema.Columns {
-			columns = append(columns, escapeIdentifier(col.Name))
-		}
+	columns, err := b.selectColumns(tableSchema, params.Fields)
+	if err != nil {
+		return "", nil, err
+	}
+
+	conditions, err := b.rowConditions(tableSchema)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Escape table name
 	escapedTable := escapeIdentifier(table)
 	query := b.sb.Select(columns...).From(escapedTable)
 
+	for _, cond := range conditions {
+		query = query.Where(cond)
+	}
+
 	for _, filter := range params.Filters {
-		if _, ok := tableSchema.Columns[strings.ToLower(filter.Field)]; !ok {
-			return "", nil, fmt.Errorf("unknown column '%s' in table '%s'", filter.Field, table)
+		if err := b.lookupFilterColumn(tableSchema, filter.Field); err != nil {
+			return "", nil, err
 		}
 
 		query = applyFilter(query, filter)
 	}
 
 	if params.Sorting != nil {
-		if _, ok := tableSchema.Columns[strings.ToLower(params.Sorting.Field)]; !ok {
-			return "", nil, fmt.Errorf("unknown column '%s' for sorting", params.Sorting.Field)
+		if err := b.lookupFilterColumn(tableSchema, params.Sorting.Field); err != nil {
+			return "", nil, err
 		}
 		orderClause := escapeIdentifier(params.Sorting.Field)
 		if params.Sorting.Direction == "desc" {
@@ -102,19 +344,9 @@ func (b *Builder) BuildSelectByID(table string, id interface{}, fields []string)
 		return "", nil, fmt.Errorf("table '%s' has no primary key", table)
 	}
 
-	var columns []string
-	if len(fields) > 0 {
-		for _, field := range fields {
-			if _, ok := tableSchema.Columns[strings.ToLower(field)]; !ok {
-				return "", nil, fmt.Errorf("unknown column '%s' in table '%s'", field, table)
-			}
-			columns = append(columns, escapeIdentifier(field))
-		}
-	} else {
-		// Use original column names from schema
-		for _, col := range tableSchema.Columns {
-			columns = append(columns, escapeIdentifier(col.Name))
-		}
+	columns, err := b.selectColumns(tableSchema, fields)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Get the original PK column name (not lowercase key)
@@ -123,6 +355,11 @@ func (b *Builder) BuildSelectByID(table string, id interface{}, fields []string)
 		return "", nil, fmt.Errorf("primary key column not found")
 	}
 
+	conditions, err := b.rowConditions(tableSchema)
+	if err != nil {
+		return "", nil, err
+	}
+
 	escapedTable := escapeIdentifier(table)
 	escapedPK := escapeIdentifier(pkCol.Name)
 
@@ -131,19 +368,36 @@ func (b *Builder) BuildSelectByID(table string, id interface{}, fields []string)
 		Where(sq.Eq{escapedPK: id}).
 		Limit(1)
 
+	for _, cond := range conditions {
+		query = query.Where(cond)
+	}
+
 	return query.ToSql()
 }
 
 func (b *Builder) BuildCount(table string, params *QueryParams) (string, []interface{}, error) {
-	_, exists := b.schema.Get(table)
+	tableSchema, exists := b.schema.Get(table)
 	if !exists {
 		return "", nil, fmt.Errorf("table '%s' not found", table)
 	}
 
+	conditions, err := b.rowConditions(tableSchema)
+	if err != nil {
+		return "", nil, err
+	}
+
 	escapedTable := escapeIdentifier(table)
 	query := b.sb.Select("COUNT(*) as count").From(escapedTable)
 
+	for _, cond := range conditions {
+		query = query.Where(cond)
+	}
+
 	for _, filter := range params.Filters {
+		if err := b.lookupFilterColumn(tableSchema, filter.Field); err != nil {
+			return "", nil, err
+		}
+
 		query = applyFilter(query, filter)
 	}
 
@@ -156,6 +410,11 @@ func (b *Builder) BuildInsert(table string, data map[string]interface{}) (string
 		return "", nil, fmt.Errorf("table '%s' not found", table)
 	}
 
+	data, err := b.applyRowValues(tableSchema, data, true)
+	if err != nil {
+		return "", nil, err
+	}
+
 	columns := make([]string, 0, len(data))
 	values := make([]interface{}, 0, len(data))
 
@@ -169,6 +428,10 @@ func (b *Builder) BuildInsert(table string, data map[string]interface{}) (string
 			continue
 		}
 
+		if !b.columns.CanWrite(table, colInfo.Name, security.OperationCreate) {
+			return "", nil, fmt.Errorf("column '%s' in table '%s' is read-only", colInfo.Name, table)
+		}
+
 		// Use escaped column name from schema
 		columns = append(columns, escapeIdentifier(colInfo.Name))
 		values = append(values, val)
@@ -192,6 +455,11 @@ func (b *Builder) BuildUpdate(table string, id interface{}, data map[string]inte
 		return "", nil, fmt.Errorf("table '%s' has no primary key", table)
 	}
 
+	data, err := b.applyRowValues(tableSchema, data, false)
+	if err != nil {
+		return "", nil, err
+	}
+
 	updateData := make(map[string]interface{})
 	for col, val := range data {
 		colInfo, ok := tableSchema.Columns[strings.ToLower(col)]
@@ -203,6 +471,10 @@ func (b *Builder) BuildUpdate(table string, id interface{}, data map[string]inte
 			continue
 		}
 
+		if !b.columns.CanWrite(table, colInfo.Name, security.OperationUpdate) {
+			return "", nil, fmt.Errorf("column '%s' in table '%s' cannot be updated", colInfo.Name, table)
+		}
+
 		// Use escaped column name from schema
 		updateData[escapeIdentifier(colInfo.Name)] = val
 	}
@@ -217,6 +489,11 @@ func (b *Builder) BuildUpdate(table string, id interface{}, data map[string]inte
 		return "", nil, fmt.Errorf("primary key column not found")
 	}
 
+	conditions, err := b.rowConditions(tableSchema)
+	if err != nil {
+		return "", nil, err
+	}
+
 	escapedTable := escapeIdentifier(table)
 	escapedPK := escapeIdentifier(pkCol.Name)
 
@@ -224,6 +501,10 @@ func (b *Builder) BuildUpdate(table string, id interface{}, data map[string]inte
 		SetMap(updateData).
 		Where(sq.Eq{escapedPK: id})
 
+	for _, cond := range conditions {
+		query = query.Where(cond)
+	}
+
 	return query.ToSql()
 }
 
@@ -243,12 +524,21 @@ func (b *Builder) BuildDelete(table string, id interface{}) (string, []interface
 		return "", nil, fmt.Errorf("primary key column not found")
 	}
 
+	conditions, err := b.rowConditions(tableSchema)
+	if err != nil {
+		return "", nil, err
+	}
+
 	escapedTable := escapeIdentifier(table)
 	escapedPK := escapeIdentifier(pkCol.Name)
 
 	query := b.sb.Delete(escapedTable).
 		Where(sq.Eq{escapedPK: id})
 
+	for _, cond := range conditions {
+		query = query.Where(cond)
+	}
+
 	return query.ToSql()
 }
 
@@ -0,0 +1,202 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+func testBuilder(t *testing.T, policies map[string]config.RowPolicyConfig) *Builder {
+	t.Helper()
+
+	schema := mysql.NewSchemaCache()
+	schema.Set("orders", &mysql.TableSchema{
+		Name:       "orders",
+		PrimaryKey: "id",
+		Columns: map[string]mysql.ColumnInfo{
+			"id":        {Name: "id", GoType: "int64", IsPrimaryKey: true},
+			"user_id":   {Name: "user_id", GoType: "int64"},
+			"tenant_id": {Name: "tenant_id", GoType: "string"},
+			"total":     {Name: "total", GoType: "float64"},
+		},
+	})
+
+	rows, err := security.NewRowPolicies(policies)
+	if err != nil {
+		t.Fatalf("NewRowPolicies: %v", err)
+	}
+	return NewBuilder(schema, nil, rows)
+}
+
+func TestRowConditions(t *testing.T) {
+	policies := map[string]config.RowPolicyConfig{
+		"orders": {Filters: []string{"user_id = claims.uid"}, BypassRoles: []string{"admin"}},
+	}
+
+	tests := []struct {
+		name     string
+		claims   *security.Claims
+		tenant   string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "claim value coerced to column type",
+			claims:   &security.Claims{UserID: "42"},
+			wantSQL:  "`user_id` = ?",
+			wantArgs: []interface{}{int64(42)},
+		},
+		{
+			name:    "missing claim denies every row",
+			claims:  &security.Claims{Username: "alice"},
+			wantSQL: "1 = 0",
+		},
+		{
+			name:    "anonymous caller denied",
+			claims:  nil,
+			wantSQL: "1 = 0",
+		},
+		{
+			name:   "bypass role",
+			claims: &security.Claims{UserID: "42", Roles: []string{"admin"}},
+		},
+		{
+			name:     "tenant added to policy",
+			claims:   &security.Claims{UserID: "7"},
+			tenant:   "acme",
+			wantSQL:  "`user_id` = ? AND `tenant_id` = ?",
+			wantArgs: []interface{}{int64(7), "acme"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBuilder(t, policies).ForClaims(tt.claims)
+			if tt.tenant != "" {
+				b = b.ForTenant("tenant_id", tt.tenant)
+			}
+			tableSchema, _ := b.schema.Get("orders")
+
+			conditions, err := b.rowConditions(tableSchema)
+			if err != nil {
+				t.Fatalf("rowConditions: %v", err)
+			}
+			if tt.wantSQL == "" {
+				if len(conditions) != 0 {
+					t.Fatalf("got %d conditions, want none", len(conditions))
+				}
+				return
+			}
+
+			sql, args, err := sq.And(conditions).ToSql()
+			if err != nil {
+				t.Fatalf("ToSql: %v", err)
+			}
+			if sql != "("+tt.wantSQL+")" {
+				t.Errorf("sql = %q, want %q", sql, "("+tt.wantSQL+")")
+			}
+			if len(args) != len(tt.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestApplyRowPolicy(t *testing.T) {
+	force := map[string]config.RowPolicyConfig{
+		"orders": {Filters: []string{"user_id = claims.uid"}},
+	}
+	reject := map[string]config.RowPolicyConfig{
+		"orders": {Filters: []string{"user_id = claims.uid"}, OnInsert: "reject"},
+	}
+
+	tests := []struct {
+		name     string
+		policies map[string]config.RowPolicyConfig
+		claims   *security.Claims
+		data     map[string]interface{}
+		insert   bool
+		want     map[string]interface{}
+		wantErr  error
+	}{
+		{
+			name:     "insert sets policy column",
+			policies: force,
+			claims:   &security.Claims{UserID: "42"},
+			data:     map[string]interface{}{"total": 10.0},
+			insert:   true,
+			want:     map[string]interface{}{"total": 10.0, "user_id": int64(42)},
+		},
+		{
+			name:     "insert overwrites other owner",
+			policies: force,
+			claims:   &security.Claims{UserID: "42"},
+			data:     map[string]interface{}{"USER_ID": 7.0},
+			insert:   true,
+			want:     map[string]interface{}{"user_id": int64(42)},
+		},
+		{
+			name:     "update without policy column left alone",
+			policies: force,
+			claims:   &security.Claims{UserID: "42"},
+			data:     map[string]interface{}{"total": 10.0},
+			want:     map[string]interface{}{"total": 10.0},
+		},
+		{
+			name:     "reject mode refuses other owner",
+			policies: reject,
+			claims:   &security.Claims{UserID: "42"},
+			data:     map[string]interface{}{"user_id": 7.0},
+			insert:   true,
+			wantErr:  security.ErrRowPolicyViolation,
+		},
+		{
+			name:     "reject mode accepts own value",
+			policies: reject,
+			claims:   &security.Claims{UserID: "42"},
+			data:     map[string]interface{}{"user_id": int64(42)},
+			insert:   true,
+			want:     map[string]interface{}{"user_id": int64(42)},
+		},
+		{
+			name:     "missing claim refuses the write",
+			policies: force,
+			claims:   &security.Claims{Username: "alice"},
+			data:     map[string]interface{}{"total": 10.0},
+			insert:   true,
+			wantErr:  security.ErrMissingClaim,
+		},
+		{
+			name:   "table without policy",
+			claims: &security.Claims{UserID: "42"},
+			data:   map[string]interface{}{"user_id": 7.0},
+			insert: true,
+			want:   map[string]interface{}{"user_id": 7.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBuilder(t, tt.policies).ForClaims(tt.claims)
+
+			got, err := b.ApplyRowPolicy("orders", tt.data, tt.insert)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyRowPolicy: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package query
+
+import (
+	"container/list"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/tracing"
+)
+
+// placeholderRun matches lists of two or more placeholders, e.g. of IN
+var placeholderRun = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+
+// Shape normalizes a statement so statements differing only in values or
+// in the length of IN lists share a shape
+func Shape(stmt string) string {
+	return placeholderRun.ReplaceAllString(tracing.SanitizeSQL(stmt), "?, ...")
+}
+
+// Stats keeps rolling duration statistics per table and statement shape.
+// Only the samples of the last window are reported. A nil *Stats records
+// nothing.
+type Stats struct {
+	window     time.Duration
+	maxShapes  int
+	maxSamples int
+
+	mu     sync.Mutex
+	shapes map[shapeKey]*list.Element
+	lru    *list.List // front is most recently recorded
+}
+
+type shapeKey struct {
+	table     string
+	statement string
+	shape     string
+}
+
+type shapeStats struct {
+	key     shapeKey
+	samples []querySample // ring buffer of the latest samples
+	next    int
+}
+
+type querySample struct {
+	at       time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// ShapeStats summarizes the samples of one shape within the window
+type ShapeStats struct {
+	Table     string    `json:"table"`
+	Statement string    `json:"statement"`
+	Shape     string    `json:"shape"`
+	Count     int       `json:"count"`
+	Errors    int       `json:"errors"`
+	P50       float64   `json:"p50_ms"`
+	P95       float64   `json:"p95_ms"`
+	P99       float64   `json:"p99_ms"`
+	Max       float64   `json:"max_ms"`
+	Total     float64   `json:"total_ms"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// NewStats returns nil when statistics are disabled
+func NewStats(cfg *config.QueryStatsConfig) *Stats {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &Stats{
+		window:     cfg.Window,
+		maxShapes:  cfg.MaxShapes,
+		maxSamples: cfg.MaxSamples,
+		shapes:     make(map[shapeKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Window returns the period statistics are computed over
+func (s *Stats) Window() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return s.window
+}
+
+// Record adds a statement of the given kind on table that took d
+func (s *Stats) Record(table, statement, stmt string, d time.Duration, failed bool) {
+	if s == nil {
+		return
+	}
+
+	key := shapeKey{table: table, statement: statement, shape: Shape(stmt)}
+	sample := querySample{at: time.Now(), duration: d, failed: failed}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.shapes[key]
+	if ok {
+		s.lru.MoveToFront(elem)
+	} else {
+		// Shapes not seen for the longest time make room for new ones
+		if len(s.shapes) >= s.maxShapes {
+			oldest := s.lru.Back()
+			delete(s.shapes, oldest.Value.(*shapeStats).key)
+			s.lru.Remove(oldest)
+		}
+		elem = s.lru.PushFront(&shapeStats{key: key})
+		s.shapes[key] = elem
+	}
+
+	st := elem.Value.(*shapeStats)
+	if len(st.samples) < s.maxSamples {
+		st.samples = append(st.samples, sample)
+		return
+	}
+	st.samples[st.next] = sample
+	st.next = (st.next + 1) % len(st.samples)
+}
+
+// Snapshot summarizes the shapes seen within the window, restricted to
+// table unless it is empty
+func (s *Stats) Snapshot(table string) []ShapeStats {
+	if s == nil {
+		return nil
+	}
+
+	since := time.Now().Add(-s.window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]ShapeStats, 0, len(s.shapes))
+	for key, elem := range s.shapes {
+		if table != "" && key.table != strings.ToLower(table) {
+			continue
+		}
+
+		summary, ok := summarize(elem.Value.(*shapeStats), since)
+		if ok {
+			result = append(result, summary)
+		}
+	}
+	return result
+}
+
+// Reset drops every recorded sample
+func (s *Stats) Reset() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shapes = make(map[shapeKey]*list.Element)
+	s.lru.Init()
+}
+
+func summarize(st *shapeStats, since time.Time) (ShapeStats, bool) {
+	summary := ShapeStats{
+		Table:     st.key.table,
+		Statement: st.key.statement,
+		Shape:     st.key.shape,
+	}
+
+	durations := make([]time.Duration, 0, len(st.samples))
+	var total time.Duration
+	for _, sample := range st.samples {
+		if sample.at.Before(since) {
+			continue
+		}
+		durations = append(durations, sample.duration)
+		total += sample.duration
+		if sample.failed {
+			summary.Errors++
+		}
+		if sample.at.After(summary.LastSeen) {
+			summary.LastSeen = sample.at
+		}
+	}
+	if len(durations) == 0 {
+		return summary, false
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	summary.Count = len(durations)
+	summary.P50 = milliseconds(percentile(durations, 0.50))
+	summary.P95 = milliseconds(percentile(durations, 0.95))
+	summary.P99 = milliseconds(percentile(durations, 0.99))
+	summary.Max = milliseconds(durations[len(durations)-1])
+	summary.Total = milliseconds(total)
+	return summary, true
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
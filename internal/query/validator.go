@@ -8,10 +8,29 @@ import (
 	"github.com/proyaai/instantgate/internal/database/mysql"
 )
 
+// ColumnError describes why a value does not fit a column. Kind is one of
+// "required", "type" or "length".
+type ColumnError struct {
+	Column   string
+	Kind     string
+	Expected string
+	Max      int64
+	Message  string
+}
+
+func (e *ColumnError) Error() string {
+	return e.Message
+}
+
+func typeError(col mysql.ColumnInfo, expected string, msg string) *ColumnError {
+	return &ColumnError{Column: col.Name, Kind: "type", Expected: expected, Message: msg}
+}
+
 func ValidateColumn(col mysql.ColumnInfo, value interface{}) error {
 	if value == nil {
 		if !col.Nullable {
-			return fmt.Errorf("column '%s' does not allow NULL values", col.Name)
+			return &ColumnError{Column: col.Name, Kind: "required",
+				Message: fmt.Sprintf("column '%s' does not allow NULL values", col.Name)}
 		}
 		return nil
 	}
@@ -24,28 +43,29 @@ func ValidateColumn(col mysql.ColumnInfo, value interface{}) error {
 		if _, ok := value.(int64); ok {
 			return nil
 		}
-		return fmt.Errorf("column '%s' expects an integer, got %T", col.Name, value)
+		return typeError(col, "integer", fmt.Sprintf("column '%s' expects an integer, got %T", col.Name, value))
 
 	case "float64":
 		if _, ok := value.(float64); ok {
 			return nil
 		}
-		return fmt.Errorf("column '%s' expects a number, got %T", col.Name, value)
+		return typeError(col, "number", fmt.Sprintf("column '%s' expects a number, got %T", col.Name, value))
 
 	case "string":
 		if _, ok := value.(string); ok {
 			if col.MaxLength.Valid && len(value.(string)) > int(col.MaxLength.Int64) {
-				return fmt.Errorf("column '%s' exceeds max length of %d", col.Name, col.MaxLength.Int64)
+				return &ColumnError{Column: col.Name, Kind: "length", Max: col.MaxLength.Int64,
+					Message: fmt.Sprintf("column '%s' exceeds max length of %d", col.Name, col.MaxLength.Int64)}
 			}
 			return nil
 		}
-		return fmt.Errorf("column '%s' expects a string, got %T", col.Name, value)
+		return typeError(col, "string", fmt.Sprintf("column '%s' expects a string, got %T", col.Name, value))
 
 	case "bool":
 		if _, ok := value.(bool); ok {
 			return nil
 		}
-		return fmt.Errorf("column '%s' expects a boolean, got %T", col.Name, value)
+		return typeError(col, "boolean", fmt.Sprintf("column '%s' expects a boolean, got %T", col.Name, value))
 
 	case "time.Time":
 		if str, ok := value.(string); ok {
@@ -53,12 +73,12 @@ func ValidateColumn(col mysql.ColumnInfo, value interface{}) error {
 			if err != nil {
 				_, err = time.Parse("2006-01-02", str)
 				if err != nil {
-					return fmt.Errorf("column '%s' expects a valid date/time format", col.Name)
+					return typeError(col, "datetime", fmt.Sprintf("column '%s' expects a valid date/time format", col.Name))
 				}
 			}
 			return nil
 		}
-		return fmt.Errorf("column '%s' expects a date/time string, got %T", col.Name, value)
+		return typeError(col, "datetime", fmt.Sprintf("column '%s' expects a date/time string, got %T", col.Name, value))
 	}
 
 	return nil
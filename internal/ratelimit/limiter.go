@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/cache"
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+// Result is the state of the most restrictive bucket of a request
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter applies the configured limits per identity and per table
+type Limiter struct {
+	cfg      *config.RateLimitConfig
+	store    Store
+	fallback *MemoryStore
+	// degraded is set while the store fails and requests use the fallback,
+	// so the change is logged once instead of on every request
+	degraded atomic.Bool
+}
+
+// NewLimiter uses Redis when a cache is available so limits are shared
+// between instances, and process memory otherwise
+func NewLimiter(cfg *config.RateLimitConfig, c *cache.Cache) *Limiter {
+	l := &Limiter{
+		cfg:      cfg,
+		fallback: NewMemoryStore(),
+	}
+
+	if c != nil {
+		l.store = NewRedisStore(c.Client())
+	} else {
+		l.store = l.fallback
+	}
+
+	return l
+}
+
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.cfg.Enabled
+}
+
+// UsesRedis reports whether limits are kept in Redis
+func (l *Limiter) UsesRedis() bool {
+	return l.Enabled() && l.store != Store(l.fallback)
+}
+
+// Allow takes a token from every bucket that applies to the request. ip
+// identifies unauthenticated callers; table and op may be empty for
+// requests that do not target a table.
+func (l *Limiter) Allow(ctx context.Context, claims *security.Claims, ip, table string, op security.Operation) Result {
+	identity := "ip:" + ip
+	if claims != nil && claims.UserID != "" {
+		identity = "user:" + claims.UserID
+	}
+
+	result := Result{Allowed: true, Remaining: -1}
+
+	if rule, ok := l.identityRule(claims); ok {
+		result = merge(result, l.take(ctx, "ratelimit:"+identity, rule))
+	}
+
+	if table != "" {
+		if rule, ok := l.tableRule(table, op); ok {
+			key := "ratelimit:" + strings.ToLower(table) + ":" + string(op) + ":" + identity
+			result = merge(result, l.take(ctx, key, rule))
+		}
+	}
+
+	return result
+}
+
+func (l *Limiter) take(ctx context.Context, key string, rule config.RateLimitRule) Result {
+	b := bucket(rule)
+
+	res, err := l.store.Take(ctx, key, b)
+	if err != nil {
+		// Keep limiting per instance while Redis is unavailable
+		if l.degraded.CompareAndSwap(false, true) {
+			slog.WarnContext(ctx, "Rate limit store failed, using in-memory buckets", "error", err)
+		}
+		res, _ = l.fallback.Take(ctx, key, b)
+		return res
+	}
+
+	if l.degraded.CompareAndSwap(true, false) {
+		slog.InfoContext(ctx, "Rate limit store recovered")
+	}
+	return res
+}
+
+// identityRule selects the rule of the caller: an identity override, else
+// the most generous rule among its roles, else the default
+func (l *Limiter) identityRule(claims *security.Claims) (config.RateLimitRule, bool) {
+	if claims != nil {
+		for _, id := range []string{claims.UserID, claims.Username} {
+			if rule, ok := l.cfg.Identities[strings.ToLower(id)]; ok && id != "" {
+				return rule, rule.Requests > 0
+			}
+		}
+	}
+
+	var best config.RateLimitRule
+	found := false
+	for _, role := range security.CallerRoles(claims) {
+		rule, ok := l.cfg.Roles[strings.ToLower(role)]
+		if !ok {
+			continue
+		}
+		if rule.Requests <= 0 {
+			// An unlimited role lifts the identity limit
+			return rule, false
+		}
+		if !found || bucket(rule).Rate > bucket(best).Rate {
+			best = rule
+			found = true
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	return l.cfg.Default, l.cfg.Default.Requests > 0
+}
+
+func (l *Limiter) tableRule(table string, op security.Operation) (config.RateLimitRule, bool) {
+	ops, ok := l.cfg.Tables[strings.ToLower(table)]
+	if !ok {
+		return config.RateLimitRule{}, false
+	}
+
+	rule, ok := ops[string(op)]
+	if !ok {
+		rule, ok = ops["*"]
+	}
+	return rule, ok && rule.Requests > 0
+}
+
+func bucket(rule config.RateLimitRule) Bucket {
+	capacity := rule.Burst
+	if capacity <= 0 {
+		capacity = rule.Requests
+	}
+	return Bucket{
+		Rate:     float64(rule.Requests) / rule.Period.Seconds(),
+		Capacity: capacity,
+	}
+}
+
+// merge keeps the more restrictive of two results
+func merge(a, b Result) Result {
+	if a.Allowed != b.Allowed {
+		if !a.Allowed {
+			return a
+		}
+		return b
+	}
+	if !a.Allowed {
+		if b.RetryAfter > a.RetryAfter {
+			return b
+		}
+		return a
+	}
+	if a.Remaining < 0 || b.Remaining < a.Remaining {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps token buckets. Take removes one token from the bucket at key
+// and reports the bucket state afterwards.
+type Store interface {
+	Take(ctx context.Context, key string, b Bucket) (Result, error)
+}
+
+// Bucket is a token bucket refilled at Rate tokens per second up to Capacity
+type Bucket struct {
+	Rate     float64
+	Capacity int
+}
+
+// fullAfter returns how long an empty bucket takes to fill completely
+func (b Bucket) fullAfter() time.Duration {
+	return time.Duration(float64(b.Capacity) / b.Rate * float64(time.Second))
+}
+
+// result builds the outcome of a take that left tokens in the bucket
+func (b Bucket) result(allowed bool, tokens float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     b.Capacity,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(b.Capacity) - tokens) / b.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / b.Rate * float64(time.Second))
+	}
+	return res
+}
+
+// MemoryStore keeps buckets in process memory. Limits are per instance.
+type MemoryStore struct {
+	buckets   map[string]*memoryBucket
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, b Bucket) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.prune(now)
+
+	mb, ok := m.buckets[key]
+	if !ok {
+		mb = &memoryBucket{tokens: float64(b.Capacity), updated: now}
+		m.buckets[key] = mb
+	}
+
+	mb.tokens = math.Min(float64(b.Capacity), mb.tokens+now.Sub(mb.updated).Seconds()*b.Rate)
+	mb.updated = now
+
+	allowed := mb.tokens >= 1
+	if allowed {
+		mb.tokens--
+	}
+	mb.full = now.Add(b.fullAfter())
+
+	return b.result(allowed, mb.tokens), nil
+}
+
+// prune drops buckets that have refilled completely, at most once a minute
+func (m *MemoryStore) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < time.Minute {
+		return
+	}
+	m.lastPrune = now
+
+	for key, mb := range m.buckets {
+		if now.After(mb.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// takeScript refills and takes from a bucket atomically using the Redis
+// clock, so all instances share the same buckets
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps buckets in Redis so limits hold across instances
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, b Bucket) (Result, error) {
+	ttl := b.fullAfter().Milliseconds() + 1000
+
+	values, err := takeScript.Run(ctx, s.client, []string{key}, b.Rate, b.Capacity, ttl).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return b.result(allowed == 1, tokens), nil
+}
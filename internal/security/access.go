@@ -1,34 +1,116 @@
 package security
 
 import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/proyaai/instantgate/internal/config"
 )
 
+// AccessControl decides which tables are exposed through the API. Whitelist
+// and blacklist entries are case-insensitive table names, shell-style globs
+// such as "audit_*" or regular expressions between slashes such as
+// "/^tmp_[0-9]+$/". Entries starting with "!" exclude matching tables, e.g.
+// a whitelist of ["*", "!*_secret"].
 type AccessControl struct {
-	cfg          *config.SecurityConfig
-	whitelistMap map[string]bool
-	blacklistMap map[string]bool
-	mu           sync.RWMutex
+	cfg       *config.SecurityConfig
+	whitelist []string
+	blacklist []string
+	allow     tablePatterns
+	deny      tablePatterns
+	// tables holds the decision for every introspected table
+	tables map[string]bool
+	known  []string
+	mu     sync.RWMutex
 }
 
-func NewAccessControl(cfg *config.SecurityConfig) *AccessControl {
-	ac := &AccessControl{
-		cfg:          cfg,
-		whitelistMap: make(map[string]bool),
-		blacklistMap: make(map[string]bool),
+func NewAccessControl(cfg *config.SecurityConfig) (*AccessControl, error) {
+	ac := &AccessControl{cfg: cfg}
+	if err := ac.Load(cfg.Whitelist, cfg.Blacklist); err != nil {
+		return nil, err
 	}
+	return ac, nil
+}
+
+// Load replaces the whitelist and blacklist. The current lists are kept when
+// a pattern is invalid.
+func (ac *AccessControl) Load(whitelist, blacklist []string) error {
+	allow, err := compileTablePatterns(whitelist)
+	if err != nil {
+		return fmt.Errorf("invalid whitelist: %w", err)
+	}
+	deny, err := compileTablePatterns(blacklist)
+	if err != nil {
+		return fmt.Errorf("invalid blacklist: %w", err)
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.whitelist = append([]string{}, whitelist...)
+	ac.blacklist = append([]string{}, blacklist...)
+	ac.allow = allow
+	ac.deny = deny
+	ac.resolve()
+	return nil
+}
+
+// SetTables evaluates the lists against the introspected tables so requests
+// are answered from a lookup table. Tables outside this list, e.g. from
+// tenant databases, are matched against the patterns on each request.
+func (ac *AccessControl) SetTables(tables []string) {
+	known := make([]string, 0, len(tables))
+	for _, table := range tables {
+		known = append(known, strings.ToLower(table))
+	}
+	sort.Strings(known)
 
-	for _, table := range cfg.Whitelist {
-		ac.whitelistMap[table] = true
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.known = known
+	ac.resolve()
+
+	if !ac.cfg.Enabled {
+		return
 	}
 
-	for _, table := range cfg.Blacklist {
-		ac.blacklistMap[table] = true
+	exposed := 0
+	for _, allowed := range ac.tables {
+		if allowed {
+			exposed++
+		}
 	}
+	slog.Info("Table access control applied", "exposed", exposed, "tables", len(known))
 
-	return ac
+	for _, pattern := range append(ac.allow.unused(known), ac.deny.unused(known)...) {
+		slog.Warn("Table pattern matches no table", "pattern", pattern)
+	}
+}
+
+// resolve recomputes the decision for the known tables. Callers must hold
+// ac.mu.
+func (ac *AccessControl) resolve() {
+	tables := make(map[string]bool, len(ac.known))
+	for _, table := range ac.known {
+		tables[table] = ac.evaluate(table)
+	}
+	ac.tables = tables
+}
+
+// evaluate matches table against the lists. Callers must hold ac.mu.
+func (ac *AccessControl) evaluate(table string) bool {
+	if len(ac.deny) > 0 && ac.deny.match(table) {
+		return false
+	}
+
+	if len(ac.allow) == 0 {
+		return true
+	}
+
+	return ac.allow.match(table)
 }
 
 func (ac *AccessControl) IsTableAllowed(table string) bool {
@@ -36,62 +118,164 @@ func (ac *AccessControl) IsTableAllowed(table string) bool {
 		return true
 	}
 
+	table = strings.ToLower(table)
+
 	ac.mu.RLock()
 	defer ac.mu.RUnlock()
 
-	if ac.blacklistMap[table] {
-		return false
+	if allowed, ok := ac.tables[table]; ok {
+		return allowed
 	}
 
-	if len(ac.whitelistMap) == 0 {
-		return true
-	}
+	return ac.evaluate(table)
+}
 
-	return ac.whitelistMap[table]
+// AllowedTables filters tables down to the ones exposed by the lists
+func (ac *AccessControl) AllowedTables(tables []string) []string {
+	result := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if ac.IsTableAllowed(table) {
+			result = append(result, table)
+		}
+	}
+	return result
 }
 
-func (ac *AccessControl) AddToWhitelist(table string) {
-	ac.mu.Lock()
-	defer ac.mu.Unlock()
-	ac.whitelistMap[table] = true
+func (ac *AccessControl) AddToWhitelist(pattern string) error {
+	return ac.Load(appendPattern(ac.GetWhitelist(), pattern), ac.GetBlacklist())
 }
 
-func (ac *AccessControl) AddToBlacklist(table string) {
-	ac.mu.Lock()
-	defer ac.mu.Unlock()
-	ac.blacklistMap[table] = true
+func (ac *AccessControl) AddToBlacklist(pattern string) error {
+	return ac.Load(ac.GetWhitelist(), appendPattern(ac.GetBlacklist(), pattern))
 }
 
-func (ac *AccessControl) RemoveFromWhitelist(table string) {
-	ac.mu.Lock()
-	defer ac.mu.Unlock()
-	delete(ac.whitelistMap, table)
+func (ac *AccessControl) RemoveFromWhitelist(pattern string) {
+	ac.Load(removePattern(ac.GetWhitelist(), pattern), ac.GetBlacklist())
 }
 
-func (ac *AccessControl) RemoveFromBlacklist(table string) {
-	ac.mu.Lock()
-	defer ac.mu.Unlock()
-	delete(ac.blacklistMap, table)
+func (ac *AccessControl) RemoveFromBlacklist(pattern string) {
+	ac.Load(ac.GetWhitelist(), removePattern(ac.GetBlacklist(), pattern))
 }
 
 func (ac *AccessControl) GetWhitelist() []string {
 	ac.mu.RLock()
 	defer ac.mu.RUnlock()
-
-	result := make([]string, 0, len(ac.whitelistMap))
-	for table := range ac.whitelistMap {
-		result = append(result, table)
-	}
-	return result
+	return append([]string{}, ac.whitelist...)
 }
 
 func (ac *AccessControl) GetBlacklist() []string {
 	ac.mu.RLock()
 	defer ac.mu.RUnlock()
+	return append([]string{}, ac.blacklist...)
+}
+
+// ValidateTablePatterns reports the first invalid pattern of patterns
+func ValidateTablePatterns(patterns []string) error {
+	_, err := compileTablePatterns(patterns)
+	return err
+}
+
+// tablePattern is a compiled whitelist or blacklist entry
+type tablePattern struct {
+	raw    string
+	negate bool
+	glob   string
+	re     *regexp.Regexp
+}
+
+func (p tablePattern) match(table string) bool {
+	if p.re != nil {
+		return p.re.MatchString(table)
+	}
+	return matchTable(p.glob, table)
+}
+
+type tablePatterns []tablePattern
+
+func compileTablePatterns(patterns []string) (tablePatterns, error) {
+	compiled := make(tablePatterns, 0, len(patterns))
+	for _, raw := range patterns {
+		p := tablePattern{raw: raw}
+
+		expr := strings.TrimSpace(raw)
+		if strings.HasPrefix(expr, "!") {
+			p.negate = true
+			expr = strings.TrimSpace(expr[1:])
+		}
+		if expr == "" {
+			return nil, fmt.Errorf("empty table pattern %q", raw)
+		}
+
+		if len(expr) > 2 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+			re, err := regexp.Compile("(?i)" + expr[1:len(expr)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %w", raw, err)
+			}
+			p.re = re
+		} else {
+			p.glob = strings.ToLower(expr)
+			if err := checkGlob(p.glob); err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %w", raw, err)
+			}
+		}
+
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// match reports whether table matches a pattern of the list and no negated
+// pattern. A list of only negated patterns matches every other table.
+func (ps tablePatterns) match(table string) bool {
+	matched, positive := false, false
+	for _, p := range ps {
+		if p.negate {
+			if p.match(table) {
+				return false
+			}
+			continue
+		}
+		positive = true
+		if !matched && p.match(table) {
+			matched = true
+		}
+	}
+	return matched || !positive
+}
+
+// unused returns the patterns that match none of tables
+func (ps tablePatterns) unused(tables []string) []string {
+	var result []string
+	for _, p := range ps {
+		used := false
+		for _, table := range tables {
+			if p.match(table) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			result = append(result, p.raw)
+		}
+	}
+	return result
+}
+
+func appendPattern(patterns []string, pattern string) []string {
+	for _, p := range patterns {
+		if p == pattern {
+			return patterns
+		}
+	}
+	return append(patterns, pattern)
+}
 
-	result := make([]string, 0, len(ac.blacklistMap))
-	for table := range ac.blacklistMap {
-		result = append(result, table)
+func removePattern(patterns []string, pattern string) []string {
+	result := patterns[:0]
+	for _, p := range patterns {
+		if p != pattern {
+			result = append(result, p)
+		}
 	}
 	return result
 }
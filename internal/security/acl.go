@@ -0,0 +1,333 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/proyaai/instantgate/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+// ACL is the part of the security configuration that can be changed at
+// runtime: the table lists and the role permissions
+type ACL struct {
+	Whitelist []string                       `json:"whitelist" yaml:"whitelist"`
+	Blacklist []string                       `json:"blacklist" yaml:"blacklist"`
+	Roles     map[string]map[string][]string `json:"roles" yaml:"roles"`
+}
+
+// Validate checks the table patterns and the operations of the role
+// permissions
+func (a *ACL) Validate() error {
+	if err := ValidateTablePatterns(a.Whitelist); err != nil {
+		return fmt.Errorf("whitelist: %w", err)
+	}
+	if err := ValidateTablePatterns(a.Blacklist); err != nil {
+		return fmt.Errorf("blacklist: %w", err)
+	}
+	return config.ValidateRoles(a.Roles)
+}
+
+func (a ACL) clone() ACL {
+	c := ACL{
+		Whitelist: append([]string{}, a.Whitelist...),
+		Blacklist: append([]string{}, a.Blacklist...),
+		Roles:     make(map[string]map[string][]string, len(a.Roles)),
+	}
+	for role, tables := range a.Roles {
+		perms := make(map[string][]string, len(tables))
+		for table, ops := range tables {
+			perms[table] = append([]string{}, ops...)
+		}
+		c.Roles[role] = perms
+	}
+	return c
+}
+
+// ACLManager applies ACL changes to the access control and role policy,
+// persists them to the ACL file and reloads them when the config file or
+// the ACL file changes on disk
+type ACLManager struct {
+	access     *AccessControl
+	roles      *RolePolicy
+	configPath string
+	file       string
+
+	mu      sync.Mutex
+	current ACL
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewACLManager starts from the lists of cfg, overridden by the ACL file
+// when it exists
+func NewACLManager(cfg *config.Config, access *AccessControl, roles *RolePolicy) (*ACLManager, error) {
+	m := &ACLManager{
+		access:     access,
+		roles:      roles,
+		configPath: cfg.Path(),
+		file:       cfg.Security.ACLFile,
+	}
+
+	acl, err := m.read(&cfg.Security)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.apply(acl); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Current returns a copy of the active ACL
+func (m *ACLManager) Current() ACL {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current.clone()
+}
+
+// Replace validates, persists and applies acl
+func (m *ACLManager) Replace(acl ACL) error {
+	return m.Update(func(current *ACL) {
+		*current = acl.clone()
+	})
+}
+
+// Update applies fn to a copy of the active ACL, then validates, persists
+// and applies the result. The active ACL is unchanged when validation or
+// saving fails, so a change is never live without being in the ACL file.
+// Without an ACL file a change would be lost on the next reload, so it is
+// refused.
+func (m *ACLManager) Update(fn func(acl *ACL)) error {
+	if m.file == "" {
+		return ErrACLNotPersisted
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acl := m.current.clone()
+	fn(&acl)
+	if err := acl.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidACL, err)
+	}
+
+	if err := writeACLFile(m.file, acl); err != nil {
+		return fmt.Errorf("failed to save ACL file: %w", err)
+	}
+
+	if err := m.applyLocked(acl); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidACL, err)
+	}
+	return nil
+}
+
+// Reload reads the config file and the ACL file again and applies the
+// result. The active ACL is kept when either file is invalid.
+func (m *ACLManager) Reload() error {
+	base := &config.SecurityConfig{}
+	if m.configPath != "" {
+		cfg, err := config.Load(m.configPath)
+		if err != nil {
+			return err
+		}
+		base = &cfg.Security
+	} else {
+		current := m.Current()
+		base.Whitelist = current.Whitelist
+		base.Blacklist = current.Blacklist
+		base.Roles = current.Roles
+	}
+
+	acl, err := m.read(base)
+	if err != nil {
+		return err
+	}
+	return m.apply(acl)
+}
+
+// Watch reloads the ACL whenever the config file or the ACL file is written.
+// The directories are watched so files replaced by editors are picked up.
+func (m *ACLManager) Watch() error {
+	files := make(map[string]bool)
+	for _, name := range []string{m.configPath, m.file} {
+		if name == "" {
+			continue
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		files[abs] = true
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	dirs := make(map[string]bool)
+	for name := range files {
+		dir := filepath.Dir(name)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	m.mu.Lock()
+	m.watcher = watcher
+	m.done = make(chan struct{})
+	m.mu.Unlock()
+
+	go m.watch(watcher, files, m.done)
+	return nil
+}
+
+func (m *ACLManager) watch(watcher *fsnotify.Watcher, files map[string]bool, done chan struct{}) {
+	defer close(done)
+
+	// Editors and our own saves produce bursts of events; reload once the
+	// burst is over
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !files[filepath.Clean(event.Name)] || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(200*time.Millisecond, func() {
+				if err := m.Reload(); err != nil {
+					slog.Warn("Access lists not reloaded", "error", err)
+					return
+				}
+				slog.Info("Access lists reloaded", "file", event.Name)
+			})
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("File watcher error", "error", err)
+		}
+	}
+}
+
+// Close stops watching for file changes
+func (m *ACLManager) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	watcher, done := m.watcher, m.done
+	m.watcher = nil
+	m.mu.Unlock()
+
+	if watcher == nil {
+		return nil
+	}
+	err := watcher.Close()
+	<-done
+	return err
+}
+
+// read builds the ACL from base and the ACL file, which takes precedence
+// when it exists
+func (m *ACLManager) read(base *config.SecurityConfig) (ACL, error) {
+	acl := ACL{
+		Whitelist: base.Whitelist,
+		Blacklist: base.Blacklist,
+		Roles:     base.Roles,
+	}
+
+	if m.file != "" {
+		data, err := os.ReadFile(m.file)
+		switch {
+		case err == nil:
+			acl = ACL{}
+			if err := yaml.Unmarshal(data, &acl); err != nil {
+				return ACL{}, fmt.Errorf("failed to parse ACL file %s: %w", m.file, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return ACL{}, fmt.Errorf("failed to read ACL file: %w", err)
+		}
+	}
+
+	if err := acl.Validate(); err != nil {
+		return ACL{}, fmt.Errorf("%w: %v", ErrInvalidACL, err)
+	}
+	return acl.clone(), nil
+}
+
+func (m *ACLManager) apply(acl ACL) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.applyLocked(acl)
+}
+
+// applyLocked activates acl. Callers must hold m.mu.
+func (m *ACLManager) applyLocked(acl ACL) error {
+	if err := m.access.Load(acl.Whitelist, acl.Blacklist); err != nil {
+		return err
+	}
+	m.roles.Load(acl.Roles)
+	m.current = acl
+	return nil
+}
+
+// writeACLFile replaces the ACL file atomically so the watcher and readers
+// never see a partial file
+func writeACLFile(name string, acl ACL) error {
+	data, err := yaml.Marshal(acl)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".acl-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+var (
+	ErrInvalidACL      = errors.New("invalid access control list")
+	ErrACLNotPersisted = errors.New("access lists cannot be changed without an ACL file")
+)
@@ -0,0 +1,113 @@
+package security
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// ClaimMapper fills the identity fields of Claims from configurable claim
+// paths, so tokens of any identity provider work with the authorization
+// policies
+type ClaimMapper struct {
+	cfg config.ClaimMappingConfig
+}
+
+func NewClaimMapper(cfg config.ClaimMappingConfig) *ClaimMapper {
+	return &ClaimMapper{
+		cfg: cfg,
+	}
+}
+
+// Apply maps the raw claims onto the identity fields of claims
+func (m *ClaimMapper) Apply(claims *Claims) {
+	if m.cfg.UserID != "" {
+		if v, ok := LookupClaim(claims.Raw, m.cfg.UserID); ok {
+			claims.UserID = claimString(v)
+		}
+	}
+	if claims.UserID == "" {
+		claims.UserID = claims.Subject
+	}
+
+	if m.cfg.Username != "" {
+		if v, ok := LookupClaim(claims.Raw, m.cfg.Username); ok {
+			claims.Username = claimString(v)
+		}
+	}
+
+	if len(m.cfg.Roles) > 0 {
+		var roles []string
+		for _, path := range m.cfg.Roles {
+			if v, ok := LookupClaim(claims.Raw, path); ok {
+				roles = append(roles, claimStrings(v)...)
+			}
+		}
+		claims.Roles = roles
+	}
+
+	if m.cfg.Tenant != "" {
+		if v, ok := LookupClaim(claims.Raw, m.cfg.Tenant); ok {
+			claims.TenantID = claimString(v)
+		}
+	}
+}
+
+// LookupClaim resolves path in raw. The full path is tried as a claim name
+// first, so namespaced claims containing dots still match; otherwise the path
+// is split on dots and walked through nested objects.
+func LookupClaim(raw map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := raw[path]; ok {
+		return v, v != nil
+	}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+
+		nested, ok := raw[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := LookupClaim(nested, path[i+1:]); ok {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func claimString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// claimStrings converts a role claim into a list. Arrays are used as is and
+// strings are split on spaces and commas.
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case []interface{}:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			result = append(result, claimString(item))
+		}
+		return result
+	case []string:
+		return val
+	case string:
+		return strings.FieldsFunc(val, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	default:
+		return []string{claimString(val)}
+	}
+}
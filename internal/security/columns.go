@@ -0,0 +1,218 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+type Operation string
+
+const (
+	OperationRead   Operation = "read"
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+)
+
+// ReadLevel is how much of a column value a caller may see
+type ReadLevel int
+
+const (
+	ReadNone ReadLevel = iota
+	ReadMasked
+	ReadFull
+)
+
+// ColumnPolicies holds the per-table hidden, read-only and write-once columns
+// and the per-role read rules. A nil *ColumnPolicies allows everything.
+type ColumnPolicies struct {
+	tables map[string]*tableColumnPolicy
+	// maskKey keys the hash mask
+	maskKey []byte
+}
+
+type tableColumnPolicy struct {
+	hidden    map[string]bool
+	readOnly  map[string]bool
+	writeOnce map[string]bool
+	ignore    bool
+	read      map[string]*columnRead
+}
+
+type columnRead struct {
+	mask     string
+	full     []string
+	masked   []string
+	fallback ReadLevel
+}
+
+func NewColumnPolicies(cfg map[string]config.ColumnPolicyConfig, maskKey []byte) *ColumnPolicies {
+	cp := &ColumnPolicies{
+		tables:  make(map[string]*tableColumnPolicy),
+		maskKey: maskKey,
+	}
+
+	for table, policy := range cfg {
+		tp := &tableColumnPolicy{
+			hidden:    toLowerSet(policy.Hidden),
+			readOnly:  toLowerSet(policy.ReadOnly),
+			writeOnce: toLowerSet(policy.WriteOnce),
+			ignore:    strings.EqualFold(policy.OnWrite, "ignore"),
+			read:      make(map[string]*columnRead, len(policy.Read)),
+		}
+
+		for column, read := range policy.Read {
+			cr := &columnRead{
+				mask:     strings.ToLower(read.Mask),
+				full:     read.Full,
+				masked:   read.Masked,
+				fallback: ReadMasked,
+			}
+			switch strings.ToLower(read.Default) {
+			case "full":
+				cr.fallback = ReadFull
+			case "none":
+				cr.fallback = ReadNone
+			}
+			tp.read[strings.ToLower(column)] = cr
+		}
+
+		cp.tables[strings.ToLower(table)] = tp
+	}
+
+	return cp
+}
+
+func (cp *ColumnPolicies) get(table string) *tableColumnPolicy {
+	if cp == nil {
+		return nil
+	}
+	return cp.tables[strings.ToLower(table)]
+}
+
+func (cp *ColumnPolicies) IsHidden(table, column string) bool {
+	policy := cp.get(table)
+	return policy != nil && policy.hidden[strings.ToLower(column)]
+}
+
+func (cp *ColumnPolicies) IsReadOnly(table, column string) bool {
+	policy := cp.get(table)
+	return policy != nil && policy.readOnly[strings.ToLower(column)]
+}
+
+func (cp *ColumnPolicies) IsWriteOnce(table, column string) bool {
+	policy := cp.get(table)
+	return policy != nil && policy.writeOnce[strings.ToLower(column)]
+}
+
+// ReadAccess returns how much of column the given roles may see. Hidden
+// columns are never visible; columns without a read rule are fully visible.
+func (cp *ColumnPolicies) ReadAccess(table, column string, roles []string) ReadLevel {
+	policy := cp.get(table)
+	if policy == nil {
+		return ReadFull
+	}
+
+	column = strings.ToLower(column)
+	if policy.hidden[column] {
+		return ReadNone
+	}
+
+	read, ok := policy.read[column]
+	if !ok {
+		return ReadFull
+	}
+
+	claims := &Claims{Roles: roles}
+	if claims.HasAnyRole(read.full...) {
+		return ReadFull
+	}
+	if claims.HasAnyRole(read.masked...) {
+		return ReadMasked
+	}
+	return read.fallback
+}
+
+// ApplyReadAccess removes the columns the roles cannot see from rows and
+// masks the ones they may only see partially
+func (cp *ColumnPolicies) ApplyReadAccess(table string, roles []string, rows []map[string]interface{}) {
+	policy := cp.get(table)
+	if policy == nil || len(policy.read) == 0 {
+		return
+	}
+
+	for _, row := range rows {
+		for col, val := range row {
+			read, ok := policy.read[strings.ToLower(col)]
+			if !ok {
+				continue
+			}
+
+			switch cp.ReadAccess(table, col, roles) {
+			case ReadNone:
+				delete(row, col)
+			case ReadMasked:
+				row[col] = MaskValue(read.mask, val, cp.maskKey)
+			}
+		}
+	}
+}
+
+// CanWrite reports whether column may be written by the given operation.
+// Hidden and read-only columns are never writable, write-once columns only on
+// create.
+func (cp *ColumnPolicies) CanWrite(table, column string, op Operation) bool {
+	if cp.IsHidden(table, column) || cp.IsReadOnly(table, column) {
+		return false
+	}
+	if op != OperationCreate && cp.IsWriteOnce(table, column) {
+		return false
+	}
+	return true
+}
+
+// FilterWrite applies the write policy of table to data. Protected columns
+// are dropped when the table is configured with on_write: ignore, otherwise
+// they are reported as violations keyed by column name.
+func (cp *ColumnPolicies) FilterWrite(table string, data map[string]interface{}, op Operation) (map[string]interface{}, map[string]string) {
+	policy := cp.get(table)
+	if policy == nil {
+		return data, nil
+	}
+
+	allowed := make(map[string]interface{}, len(data))
+	violations := make(map[string]string)
+
+	for col, val := range data {
+		if cp.CanWrite(table, col, op) {
+			allowed[col] = val
+			continue
+		}
+
+		if policy.ignore {
+			continue
+		}
+
+		if cp.IsHidden(table, col) || cp.IsReadOnly(table, col) {
+			violations[col] = fmt.Sprintf("Column '%s' is read-only", col)
+		} else {
+			violations[col] = fmt.Sprintf("Column '%s' can only be set on create", col)
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, violations
+	}
+
+	return allowed, nil
+}
+
+func toLowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
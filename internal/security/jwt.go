@@ -1,8 +1,12 @@
 package security
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,9 +15,16 @@ import (
 )
 
 type JWTManager struct {
-	secretKey []byte
-	expiry    time.Duration
-	issuer    string
+	secretKey     []byte
+	expiry        time.Duration
+	refreshExpiry time.Duration
+	issuer        string
+	issuers       []string
+	audience      []string
+	leeway        time.Duration
+	methods       []string
+	keys          *KeySet
+	mapper        *ClaimMapper
 }
 
 type Claims struct {
@@ -22,17 +33,219 @@ type Claims struct {
 	Username  string   `json:"username,omitempty"`
 	Roles     []string `json:"roles,omitempty"`
 	TokenType string   `json:"type,omitempty"`
+	TenantID  string   `json:"-"`
+	// Tables restricts the identity to these table patterns, e.g. for API keys
+	Tables []string `json:"-"`
+	// Raw holds every claim of the token, including non-standard ones
+	Raw map[string]interface{} `json:"-"`
 }
 
-func NewJWTManager(cfg *config.JWTConfig) *JWTManager {
-	return &JWTManager{
-		secretKey: []byte(cfg.Secret),
-		expiry:    cfg.Expiry,
-		issuer:    cfg.Issuer,
+// Token types carried in the "type" claim of issued tokens
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plainClaims Claims
+	if err := json.Unmarshal(data, (*plainClaims)(c)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.Raw)
+}
+
+type claimsContextKey struct{}
+
+// WithClaims returns a copy of ctx carrying the authenticated claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// Claim returns the value of a named claim such as "uid", "sub" or "username".
+// Other names are looked up in the raw token claims.
+func (c *Claims) Claim(name string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	var value string
+	switch strings.ToLower(name) {
+	case "uid", "user_id":
+		value = c.UserID
+	case "sub":
+		value = c.Subject
+	case "username":
+		value = c.Username
+	case "iss":
+		value = c.Issuer
+	case "jti":
+		value = c.ID
+	case "type":
+		value = c.TokenType
+	case "tenant", "tenant_id":
+		if c.TenantID == "" {
+			return LookupClaim(c.Raw, name)
+		}
+		value = c.TenantID
+	default:
+		return LookupClaim(c.Raw, name)
+	}
+
+	if value == "" {
+		return nil, false
+	}
+	return value, true
+}
+
+// TableAllowed reports whether the identity may access table. Identities
+// without a table restriction may access every table.
+func (c *Claims) TableAllowed(table string) bool {
+	if c == nil || len(c.Tables) == 0 {
+		return true
 	}
+	table = strings.ToLower(table)
+	for _, pattern := range c.Tables {
+		if matchTable(strings.ToLower(pattern), table) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole reports whether the claims carry at least one of roles
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	if c == nil {
+		return false
+	}
+	for _, required := range roles {
+		for _, role := range c.Roles {
+			if strings.EqualFold(role, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func NewJWTManager(cfg *config.JWTConfig) (*JWTManager, error) {
+	keys, err := NewKeySet(cfg.PublicKeys, cfg.JWKSFile, cfg.JWKSURL, cfg.JWKSCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := make([]string, 0, len(cfg.Algorithms))
+	for _, alg := range cfg.Algorithms {
+		if strings.EqualFold(alg, "EdDSA") {
+			methods = append(methods, "EdDSA")
+			continue
+		}
+		methods = append(methods, strings.ToUpper(alg))
+	}
+	if len(methods) == 0 {
+		methods = []string{"HS256"}
+	}
+
+	issuers := make([]string, 0, len(cfg.Issuers)+1)
+	if cfg.Issuer != "" {
+		issuers = append(issuers, cfg.Issuer)
+	}
+	issuers = append(issuers, cfg.Issuers...)
+
+	j := &JWTManager{
+		secretKey:     []byte(cfg.Secret),
+		expiry:        cfg.Expiry,
+		refreshExpiry: cfg.RefreshExpiry,
+		issuer:        cfg.Issuer,
+		issuers:       issuers,
+		audience:      cfg.Audience,
+		leeway:        cfg.Leeway,
+		methods:       methods,
+		keys:          keys,
+		mapper:        NewClaimMapper(cfg.ClaimMapping),
+	}
+
+	if cfg.JWKSURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := keys.Refresh(ctx); err != nil {
+			slog.Warn("JWKS could not be loaded, retrying on first token", "error", err)
+		}
+	}
+
+	return j, nil
+}
+
+// keyFunc selects the verification key for a token: the shared secret for
+// HMAC, otherwise the public keys matching the token's key ID
+func (j *JWTManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(j.secretKey) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return j.secretKey, nil
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		kid, _ := token.Header["kid"].(string)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		keys, err := j.keys.Keys(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(keys))}
+		for _, key := range keys {
+			set.Keys = append(set.Keys, key)
+		}
+		return set, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+// TokenPair is the result of a login or refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 func (j *JWTManager) GenerateToken(userID, username string, roles []string) (string, error) {
+	return j.generate(userID, username, roles, TokenTypeAccess, j.expiry)
+}
+
+// GenerateTokenPair issues an access token and a refresh token for a user
+func (j *JWTManager) GenerateTokenPair(userID, username string, roles []string) (*TokenPair, error) {
+	access, err := j.generate(userID, username, roles, TokenTypeAccess, j.expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := j.generate(userID, username, roles, TokenTypeRefresh, j.refreshExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.expiry.Seconds()),
+	}, nil
+}
+
+func (j *JWTManager) generate(userID, username string, roles []string, tokenType string, expiry time.Duration) (string, error) {
 	now := time.Now()
 	tokenID := uuid.New().String()
 
@@ -41,27 +254,60 @@ func (j *JWTManager) GenerateToken(userID, username string, roles []string) (str
 			Issuer:    j.issuer,
 			Subject:   userID,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(j.expiry)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
 			NotBefore: jwt.NewNumericDate(now),
 			ID:        tokenID,
+			Audience:  j.audience,
 		},
 		UserID:    userID,
 		Username:  username,
 		Roles:     roles,
-		TokenType: "access",
+		TokenType: tokenType,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(j.secretKey)
 }
 
+// ValidateToken validates an access token. Refresh tokens are rejected so
+// they cannot be used to call the API.
 func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.secretKey, nil
-	})
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType == TokenTypeRefresh {
+		return nil, ErrWrongTokenType
+	}
+
+	return claims, nil
+}
+
+// ValidateRefreshToken validates a token issued as refresh token
+func (j *JWTManager) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != TokenTypeRefresh {
+		return nil, ErrWrongTokenType
+	}
+
+	return claims, nil
+}
+
+func (j *JWTManager) parse(tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(j.methods),
+		jwt.WithLeeway(j.leeway),
+	}
+	if len(j.audience) > 0 {
+		opts = append(opts, jwt.WithAudience(j.audience...))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.keyFunc, opts...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -78,20 +324,33 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, ErrTokenInvalid
 	}
 
-	if claims.Issuer != j.issuer {
+	if len(j.issuers) > 0 && !containsString(j.issuers, claims.Issuer) {
 		return nil, ErrInvalidIssuer
 	}
 
+	j.mapper.Apply(claims)
+
 	return claims, nil
 }
 
-func (j *JWTManager) RefreshToken(tokenString string) (string, error) {
-	claims, err := j.ValidateToken(tokenString)
+// RefreshToken exchanges a refresh token for a new token pair. The refresh
+// token is rotated along with the access token.
+func (j *JWTManager) RefreshToken(tokenString string) (*TokenPair, error) {
+	claims, err := j.ValidateRefreshToken(tokenString)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return j.GenerateToken(claims.UserID, claims.Username, claims.Roles)
+	return j.GenerateTokenPair(claims.UserID, claims.Username, claims.Roles)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 var (
@@ -100,4 +359,6 @@ var (
 	ErrTokenInvalid   = errors.New("token is invalid")
 	ErrInvalidIssuer  = errors.New("invalid token issuer")
 	ErrNoToken        = errors.New("no token provided")
+	ErrWrongTokenType = errors.New("wrong token type")
+	ErrTokenRevoked   = errors.New("token has been revoked")
 )
@@ -0,0 +1,355 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minJWKSRefresh limits how often an unknown key ID triggers a JWKS fetch
+const minJWKSRefresh = time.Minute
+
+// KeySet holds the public keys used to verify asymmetrically signed tokens.
+// Keys come from PEM files, a local JWKS file and a remote JWKS URL.
+type KeySet struct {
+	static  []crypto.PublicKey
+	byKID   map[string]crypto.PublicKey
+	remote  map[string]crypto.PublicKey
+	url     string
+	ttl     time.Duration
+	fetched time.Time
+	client  *http.Client
+	mu      sync.RWMutex
+	fetchMu sync.Mutex
+}
+
+func NewKeySet(pemFiles []string, jwksFile, jwksURL string, ttl time.Duration) (*KeySet, error) {
+	ks := &KeySet{
+		byKID:  make(map[string]crypto.PublicKey),
+		remote: make(map[string]crypto.PublicKey),
+		url:    jwksURL,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, file := range pemFiles {
+		key, err := loadPEMKey(file)
+		if err != nil {
+			return nil, err
+		}
+		ks.static = append(ks.static, key)
+	}
+
+	if jwksFile != "" {
+		data, err := os.ReadFile(jwksFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		keys, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS file %s: %w", jwksFile, err)
+		}
+		ks.byKID = keys
+	}
+
+	return ks, nil
+}
+
+// Empty reports whether no key source is configured
+func (ks *KeySet) Empty() bool {
+	return len(ks.static) == 0 && len(ks.byKID) == 0 && ks.url == ""
+}
+
+// Keys returns the candidate verification keys for a token header. Tokens
+// carrying an unknown key ID trigger a JWKS refresh, rate limited to one
+// fetch per minute.
+func (ks *KeySet) Keys(ctx context.Context, kid string) ([]crypto.PublicKey, error) {
+	if ks.url != "" && ks.expired() {
+		if err := ks.refreshIf(ctx, ks.expired); err != nil && !ks.hasRemote() {
+			return nil, err
+		}
+	}
+
+	if kid != "" {
+		if key, ok := ks.lookup(kid); ok {
+			return []crypto.PublicKey{key}, nil
+		}
+
+		if ks.url != "" && ks.canRefresh() {
+			if err := ks.refreshIf(ctx, ks.canRefresh); err != nil {
+				return nil, err
+			}
+			if key, ok := ks.lookup(kid); ok {
+				return []crypto.PublicKey{key}, nil
+			}
+		}
+
+		if len(ks.static) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+		}
+	}
+
+	// Without a key ID every configured key is a candidate
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]crypto.PublicKey, 0, len(ks.static)+len(ks.byKID)+len(ks.remote))
+	keys = append(keys, ks.static...)
+	if kid == "" {
+		for _, key := range ks.byKID {
+			keys = append(keys, key)
+		}
+		for _, key := range ks.remote {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return keys, nil
+}
+
+// Refresh fetches the JWKS URL and replaces the remote keys
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	return ks.refreshIf(ctx, nil)
+}
+
+// refreshIf fetches the JWKS URL when needed still reports true once the
+// fetch lock is held, so a burst of requests waiting for the lock causes a
+// single fetch. A nil needed always fetches.
+func (ks *KeySet) refreshIf(ctx context.Context, needed func() bool) error {
+	if ks.url == "" {
+		return nil
+	}
+
+	ks.fetchMu.Lock()
+	defer ks.fetchMu.Unlock()
+
+	if needed != nil && !needed() {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := ks.client.Do(req)
+
+	ks.mu.Lock()
+	ks.fetched = time.Now()
+	ks.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	ks.mu.Lock()
+	ks.remote = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if key, ok := ks.remote[kid]; ok {
+		return key, true
+	}
+	key, ok := ks.byKID[kid]
+	return key, ok
+}
+
+func (ks *KeySet) hasRemote() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return len(ks.remote) > 0
+}
+
+func (ks *KeySet) expired() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.fetched.IsZero() || (ks.ttl > 0 && time.Since(ks.fetched) > ks.ttl)
+}
+
+func (ks *KeySet) canRefresh() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return time.Since(ks.fetched) > minJWKSRefresh
+}
+
+func loadPEMKey(file string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", file, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM in %s", file)
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", file, err)
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA public key %s: %w", file, err)
+		}
+		return key, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", file, err)
+		}
+		return key, nil
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the signing keys of a JWKS document keyed by key ID.
+// Keys with unsupported types are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s): %w", i, k.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+var (
+	ErrUnknownKey = errors.New("no verification key found for token")
+)
@@ -0,0 +1,216 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testKeys struct {
+	rsa *rsa.PublicKey
+	ec  *ecdsa.PublicKey
+	ed  ed25519.PublicKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa: %v", err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519: %v", err)
+	}
+	return testKeys{rsa: &rsaKey.PublicKey, ec: &ecKey.PublicKey, ed: edKey}
+}
+
+func writePEM(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write PEM: %v", err)
+	}
+	return file
+}
+
+func jwksDocument(t *testing.T, keys testKeys, kidPrefix string) []byte {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	doc := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": kidPrefix + "ec", "crv": "P-256", "x": b64(keys.ec.X.Bytes()), "y": b64(keys.ec.Y.Bytes())},
+			{"kty": "OKP", "kid": kidPrefix + "ed", "crv": "Ed25519", "x": b64(keys.ed)},
+			// Encryption and symmetric keys are skipped
+			{"kty": "OKP", "kid": kidPrefix + "enc", "use": "enc", "crv": "Ed25519", "x": b64(keys.ed)},
+			{"kty": "oct", "kid": kidPrefix + "oct"},
+		},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal JWKS: %v", err)
+	}
+	return data
+}
+
+func TestKeySetKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	pemFile := writePEM(t, keys.rsa)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwksDocument(t, keys, ""), 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+
+	withPEM, err := NewKeySet([]string{pemFile}, jwksFile, "", 0)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	jwksOnly, err := NewKeySet(nil, jwksFile, "", 0)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ks      *KeySet
+		kid     string
+		want    []crypto.PublicKey
+		wantErr error
+	}{
+		{name: "kid selects JWKS key", ks: withPEM, kid: "ed", want: []crypto.PublicKey{keys.ed}},
+		{name: "kid selects EC key", ks: jwksOnly, kid: "ec", want: []crypto.PublicKey{keys.ec}},
+		{name: "unknown kid falls back to PEM keys", ks: withPEM, kid: "other", want: []crypto.PublicKey{keys.rsa}},
+		{name: "unknown kid without PEM keys", ks: jwksOnly, kid: "other", wantErr: ErrUnknownKey},
+		{name: "encryption key not used", ks: jwksOnly, kid: "enc", wantErr: ErrUnknownKey},
+		{name: "no kid tries every key", ks: withPEM, want: []crypto.PublicKey{keys.rsa, keys.ec, keys.ed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ks.Keys(context.Background(), tt.kid)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Keys: %v", err)
+			}
+			assertSameKeys(t, got, tt.want)
+		})
+	}
+}
+
+func TestKeySetNewKIDRefreshesJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	doc := jwksDocument(t, keys, "v1-")
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	ks, err := NewKeySet(nil, "", srv.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	got, err := ks.Keys(context.Background(), "v1-ed")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	assertSameKeys(t, got, []crypto.PublicKey{keys.ed})
+
+	// Refreshing for unknown key IDs is rate limited
+	if _, err := ks.Keys(context.Background(), "v2-ed"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownKey)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func TestKeySetExpiredJWKSFetchedOnce(t *testing.T) {
+	keys := newTestKeys(t)
+	doc := jwksDocument(t, keys, "")
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	ks, err := NewKeySet(nil, "", srv.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Keys(context.Background(), "ec"); err != nil {
+				t.Errorf("Keys: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func assertSameKeys(t *testing.T, got, want []crypto.PublicKey) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d", len(got), len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if w.(interface{ Equal(crypto.PublicKey) bool }).Equal(g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("key %T missing from %v", w, got)
+		}
+	}
+}
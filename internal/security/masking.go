@@ -0,0 +1,55 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const redacted = "****"
+
+// MaskValue masks value with the given strategy: redact, partial, hash or null.
+// Unknown strategies redact. Hashes are HMAC-SHA256 with key, so values with
+// few possibilities such as emails cannot be recovered by hashing guesses.
+func MaskValue(strategy string, value interface{}, key []byte) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch strategy {
+	case "null":
+		return nil
+	case "hash":
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(fmt.Sprint(value)))
+		return hex.EncodeToString(mac.Sum(nil))
+	case "partial":
+		return maskPartial(fmt.Sprint(value))
+	default:
+		return redacted
+	}
+}
+
+// maskPartial keeps the first character (and the domain of an email address),
+// e.g. "john@example.com" becomes "j***@example.com"
+func maskPartial(s string) string {
+	runes := []rune(s)
+	if at := lastRune(runes, '@'); at > 0 {
+		return string(runes[:1]) + "***" + string(runes[at:])
+	}
+
+	if len(runes) <= 2 {
+		return "***"
+	}
+	return string(runes[:1]) + "***" + string(runes[len(runes)-1:])
+}
+
+func lastRune(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
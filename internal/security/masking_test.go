@@ -0,0 +1,62 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMaskValue(t *testing.T) {
+	key := []byte("secret")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("john@example.com"))
+	emailHash := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name     string
+		strategy string
+		value    interface{}
+		want     interface{}
+	}{
+		{"redact", "redact", "secret value", "****"},
+		{"unknown strategy redacts", "scramble", "secret value", "****"},
+		{"null", "null", "secret value", nil},
+		{"nil stays nil", "redact", nil, nil},
+		{"hash is keyed", "hash", "john@example.com", emailHash},
+		{"partial email", "partial", "john@example.com", "j***@example.com"},
+		{"partial email with @ in local part", "partial", `"a@b"@example.com`, `"***@example.com`},
+		{"partial text", "partial", "Istanbul", "I***l"},
+		{"partial short", "partial", "ab", "***"},
+		{"partial number", "partial", 123456, "1***6"},
+		{"partial multibyte", "partial", "Çağrı", "Ç***ı"},
+		{"partial multibyte email", "partial", "şule@örnek.com", "ş***@örnek.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaskValue(tt.strategy, tt.value, key)
+			if got != tt.want {
+				t.Errorf("MaskValue(%q, %v) = %v, want %v", tt.strategy, tt.value, got, tt.want)
+			}
+			if s, ok := got.(string); ok && !utf8.ValidString(s) {
+				t.Errorf("MaskValue(%q, %v) returned invalid UTF-8 %q", tt.strategy, tt.value, s)
+			}
+		})
+	}
+}
+
+func TestMaskValueHashDependsOnKey(t *testing.T) {
+	a := MaskValue("hash", "john@example.com", []byte("one"))
+	b := MaskValue("hash", "john@example.com", []byte("two"))
+	if a == b {
+		t.Errorf("hashes with different keys are equal: %v", a)
+	}
+
+	plain := sha256.Sum256([]byte("john@example.com"))
+	if a == hex.EncodeToString(plain[:]) {
+		t.Error("hash mask is an unkeyed SHA-256")
+	}
+}
@@ -0,0 +1,220 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/cache"
+)
+
+// Revocations records revoked token IDs and per-user watermarks that
+// invalidate every token issued before a point in time. Entries are kept in
+// Redis when a cache is available and in memory otherwise, and expire once
+// the tokens they cover would have expired anyway.
+type Revocations struct {
+	cache *cache.Cache
+	// maxLifetime is the longest lifetime of any accepted token
+	maxLifetime time.Duration
+
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	users     map[string]userWatermark
+	lastPrune time.Time
+}
+
+type userWatermark struct {
+	before  time.Time
+	expires time.Time
+}
+
+func NewRevocations(c *cache.Cache, maxLifetime time.Duration) *Revocations {
+	return &Revocations{
+		cache:       c,
+		maxLifetime: maxLifetime,
+		tokens:      make(map[string]time.Time),
+		users:       make(map[string]userWatermark),
+	}
+}
+
+// Revoke invalidates the token with ID jti, which expires at expires. A zero
+// expires keeps the entry for the longest token lifetime.
+func (rv *Revocations) Revoke(ctx context.Context, jti string, expires time.Time) error {
+	if jti == "" {
+		return ErrNoTokenID
+	}
+
+	if expires.IsZero() {
+		expires = time.Now().Add(rv.maxLifetime)
+	}
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if rv.cache != nil {
+		return rv.cache.SetWithTTL(ctx, revokedTokenKey(jti), true, ttl)
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.prune()
+	rv.tokens[jti] = expires
+	return nil
+}
+
+// Consume revokes the token with ID jti like Revoke and reports whether it
+// was not revoked yet. The check and the revocation are one atomic step, so
+// of concurrent requests presenting the same single-use token only one
+// succeeds.
+func (rv *Revocations) Consume(ctx context.Context, jti string, expires time.Time) (bool, error) {
+	if jti == "" {
+		return false, ErrNoTokenID
+	}
+
+	if expires.IsZero() {
+		expires = time.Now().Add(rv.maxLifetime)
+	}
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	if rv.cache != nil {
+		return rv.cache.SetNX(ctx, revokedTokenKey(jti), true, ttl)
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.prune()
+	if revoked, ok := rv.tokens[jti]; ok && time.Now().Before(revoked) {
+		return false, nil
+	}
+	rv.tokens[jti] = expires
+	return true, nil
+}
+
+// RevokeUser invalidates every token of userID issued before before
+func (rv *Revocations) RevokeUser(ctx context.Context, userID string, before time.Time) error {
+	if userID == "" {
+		return ErrNoUserID
+	}
+
+	if rv.cache != nil {
+		return rv.cache.SetWithTTL(ctx, revokedUserKey(userID), before.Unix(), rv.maxLifetime)
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.prune()
+	rv.users[userID] = userWatermark{
+		before:  before,
+		expires: time.Now().Add(rv.maxLifetime),
+	}
+	return nil
+}
+
+// IsRevoked reports whether claims belong to a revoked token
+func (rv *Revocations) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	if rv == nil || claims == nil {
+		return false, nil
+	}
+
+	if rv.cache != nil {
+		return rv.isRevokedCached(ctx, claims)
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	now := time.Now()
+	if claims.ID != "" {
+		if expires, ok := rv.tokens[claims.ID]; ok && now.Before(expires) {
+			return true, nil
+		}
+	}
+
+	if claims.UserID != "" {
+		if wm, ok := rv.users[claims.UserID]; ok && now.Before(wm.expires) {
+			return issuedBefore(claims, wm.before.Unix()), nil
+		}
+	}
+
+	return false, nil
+}
+
+// isRevokedCached fails closed: Redis errors are returned rather than
+// treating the token as valid
+func (rv *Revocations) isRevokedCached(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID != "" {
+		var revoked bool
+		err := rv.cache.Get(ctx, revokedTokenKey(claims.ID), &revoked)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			return false, fmt.Errorf("failed to read token revocation: %w", err)
+		}
+	}
+
+	if claims.UserID != "" {
+		var before int64
+		err := rv.cache.Get(ctx, revokedUserKey(claims.UserID), &before)
+		if err == nil {
+			return issuedBefore(claims, before), nil
+		}
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			return false, fmt.Errorf("failed to read revocation watermark: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+// prune drops expired in-memory entries at most once a minute. Callers must
+// hold rv.mu.
+func (rv *Revocations) prune() {
+	now := time.Now()
+	if now.Sub(rv.lastPrune) < time.Minute {
+		return
+	}
+	rv.lastPrune = now
+
+	for jti, expires := range rv.tokens {
+		if now.After(expires) {
+			delete(rv.tokens, jti)
+		}
+	}
+	for userID, wm := range rv.users {
+		if now.After(wm.expires) {
+			delete(rv.users, userID)
+		}
+	}
+}
+
+// issuedBefore reports whether the token was issued before the watermark,
+// given in Unix seconds. Issue times have second precision, so tokens issued
+// within the watermark's second stay valid; otherwise the tokens issued
+// right after a logout or password change would be rejected. Tokens without
+// an issue time are treated as revoked.
+func issuedBefore(claims *Claims, watermark int64) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return claims.IssuedAt.Unix() < watermark
+}
+
+func revokedTokenKey(jti string) string {
+	return "revoked:token:" + jti
+}
+
+func revokedUserKey(userID string) string {
+	return "revoked:user:" + userID
+}
+
+var (
+	ErrNoTokenID = errors.New("token has no ID")
+	ErrNoUserID  = errors.New("token has no user ID")
+)
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// RowCondition restricts a column to a value taken from the caller's claims
+type RowCondition struct {
+	Column string
+	Value  interface{}
+}
+
+// RowPolicies holds the row-level security filters per table.
+// A nil *RowPolicies applies no restrictions.
+type RowPolicies struct {
+	tables map[string]*rowPolicy
+}
+
+type rowPolicy struct {
+	rules  []rowRule
+	bypass []string
+	reject bool
+}
+
+type rowRule struct {
+	column string
+	claim  string
+}
+
+func NewRowPolicies(cfg map[string]config.RowPolicyConfig) (*RowPolicies, error) {
+	rp := &RowPolicies{
+		tables: make(map[string]*rowPolicy),
+	}
+
+	for table, policy := range cfg {
+		p := &rowPolicy{
+			bypass: policy.BypassRoles,
+			reject: strings.EqualFold(policy.OnInsert, "reject"),
+		}
+
+		for _, filter := range policy.Filters {
+			rule, err := parseRowFilter(filter)
+			if err != nil {
+				return nil, fmt.Errorf("invalid row policy for table %s: %w", table, err)
+			}
+			p.rules = append(p.rules, rule)
+		}
+
+		rp.tables[strings.ToLower(table)] = p
+	}
+
+	return rp, nil
+}
+
+// parseRowFilter parses "column = claims.name"
+func parseRowFilter(filter string) (rowRule, error) {
+	parts := strings.SplitN(filter, "=", 2)
+	if len(parts) != 2 {
+		return rowRule{}, fmt.Errorf("expected 'column = claims.name', got %q", filter)
+	}
+
+	column := strings.TrimSpace(parts[0])
+	claim := strings.TrimSpace(parts[1])
+
+	if column == "" || !strings.HasPrefix(claim, "claims.") || len(claim) == len("claims.") {
+		return rowRule{}, fmt.Errorf("expected 'column = claims.name', got %q", filter)
+	}
+
+	return rowRule{column: column, claim: strings.TrimPrefix(claim, "claims.")}, nil
+}
+
+// Conditions returns the row conditions for table under claims. It returns
+// ErrMissingClaim when a claim required by the policy is not available, in
+// which case callers must deny access to every row.
+func (rp *RowPolicies) Conditions(table string, claims *Claims) ([]RowCondition, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	policy, ok := rp.tables[strings.ToLower(table)]
+	if !ok || len(policy.rules) == 0 {
+		return nil, nil
+	}
+
+	if len(policy.bypass) > 0 && claims.HasAnyRole(policy.bypass...) {
+		return nil, nil
+	}
+
+	conditions := make([]RowCondition, 0, len(policy.rules))
+	for _, rule := range policy.rules {
+		value, ok := claims.Claim(rule.claim)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingClaim, rule.claim)
+		}
+		conditions = append(conditions, RowCondition{Column: rule.column, Value: value})
+	}
+
+	return conditions, nil
+}
+
+// RejectsWrites reports whether writes carrying a value different from the
+// policy value are rejected instead of overwritten
+func (rp *RowPolicies) RejectsWrites(table string) bool {
+	if rp == nil {
+		return false
+	}
+	policy, ok := rp.tables[strings.ToLower(table)]
+	return ok && policy.reject
+}
+
+var (
+	ErrMissingClaim       = errors.New("claim required by row policy is missing")
+	ErrRowPolicyViolation = errors.New("row policy violation")
+)
@@ -0,0 +1,276 @@
+package tenant
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/database/mysql"
+)
+
+// Conn is the database handle and schema used to serve one tenant. Every
+// Conn returned by Manager.Conn has to be released once the request is done
+// with it, so that evicting the tenant does not close the pool under it.
+type Conn struct {
+	DB     *sql.DB
+	Schema *mysql.SchemaCache
+
+	manager *Manager
+	tc      *tenantConn
+}
+
+// Retain takes another reference on c for work that outlives the request,
+// which releases it when done
+func (c *Conn) Retain() {
+	if c == nil || c.tc == nil {
+		return
+	}
+	c.manager.mu.Lock()
+	c.tc.refs++
+	c.manager.mu.Unlock()
+}
+
+// Release gives up a reference on c. The pool of an evicted tenant is
+// closed when its last reference is released.
+func (c *Conn) Release() {
+	if c == nil || c.tc == nil {
+		return
+	}
+	c.manager.release(c.tc)
+}
+
+// connectTimeout bounds connecting to a tenant database and loading its
+// schema. It does not depend on the request that triggered the connection,
+// whose cancellation would otherwise fail the tenant for everyone waiting.
+const connectTimeout = 10 * time.Second
+
+// Manager opens one connection pool per tenant database in schema mode.
+// Connections are opened on first use, each tenant under its own lock so a
+// slow database only delays its own tenant. At most MaxDatabases pools are
+// kept open; the least recently used is evicted to make room and closed
+// once no request uses it anymore. Failed
+// connections are remembered for FailureTTL instead of being retried on
+// every request.
+type Manager struct {
+	cfg      *config.TenancyConfig
+	dbConfig config.DatabaseConfig
+	shared   *mysql.SchemaCache
+
+	mu      sync.Mutex
+	tenants map[string]*tenantConn
+	lru     *list.List // front is most recently used
+}
+
+type tenantConn struct {
+	id string
+	// ready is closed once connecting finished; the fields below are
+	// read-only afterwards. done is ready's state guarded by Manager.mu.
+	ready        chan struct{}
+	done         bool
+	introspector *mysql.Introspector
+	conn         *Conn
+	err          error
+	// retryAt is when a failed connection is attempted again
+	retryAt time.Time
+
+	// refs counts the requests using the pool; removed and closed record
+	// eviction and closing. All three are guarded by Manager.mu, so the pool
+	// is closed exactly once, after it was removed and its last user is done.
+	refs    int
+	removed bool
+	closed  bool
+
+	elem *list.Element
+}
+
+func NewManager(cfg *config.TenancyConfig, dbCfg *config.DatabaseConfig, shared *mysql.SchemaCache) *Manager {
+	return &Manager{
+		cfg:      cfg,
+		dbConfig: *dbCfg,
+		shared:   shared,
+		tenants:  make(map[string]*tenantConn),
+		lru:      list.New(),
+	}
+}
+
+// DatabaseName returns the database that holds the data of tenant id
+func (m *Manager) DatabaseName(id string) string {
+	return strings.ReplaceAll(m.cfg.DatabaseTemplate, "{tenant}", id)
+}
+
+// Conn returns the connection of tenant id, connecting and loading its
+// schema on first use unless the schema is shared. The caller has to
+// release the connection.
+func (m *Manager) Conn(ctx context.Context, id string) (*Conn, error) {
+	m.mu.Lock()
+	tc, ok := m.tenants[id]
+	if ok && tc.done && tc.err != nil && !time.Now().Before(tc.retryAt) {
+		m.removeLocked(tc)
+		ok = false
+	}
+
+	var evicted []*mysql.Introspector
+	if ok {
+		m.lru.MoveToFront(tc.elem)
+	} else {
+		tc = &tenantConn{id: id, ready: make(chan struct{})}
+		evicted = m.evictLocked()
+		tc.elem = m.lru.PushFront(tc)
+		m.tenants[id] = tc
+	}
+	// Taken before waiting, so the pool cannot be closed between connecting
+	// and being handed out
+	tc.refs++
+	m.mu.Unlock()
+
+	if !ok {
+		closeAll(evicted)
+		go m.connect(ctx, tc)
+	}
+
+	select {
+	case <-tc.ready:
+		if tc.err != nil {
+			m.release(tc)
+			return nil, tc.err
+		}
+		return tc.conn, nil
+	case <-ctx.Done():
+		m.release(tc)
+		return nil, ctx.Err()
+	}
+}
+
+// release drops a reference on tc and closes its pool when it was the last
+// one of an evicted tenant
+func (m *Manager) release(tc *tenantConn) {
+	m.mu.Lock()
+	tc.refs--
+	closing := m.closableLocked(tc)
+	m.mu.Unlock()
+
+	if closing {
+		closeAll([]*mysql.Introspector{tc.introspector})
+	}
+}
+
+// closableLocked reports whether the pool of tc has to be closed now, and
+// marks it closed if so
+func (m *Manager) closableLocked(tc *tenantConn) bool {
+	if !tc.removed || tc.closed || !tc.done || tc.refs > 0 || tc.introspector == nil {
+		return false
+	}
+	tc.closed = true
+	return true
+}
+
+// connect opens the database of tc and publishes the result
+func (m *Manager) connect(ctx context.Context, tc *tenantConn) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), connectTimeout)
+	defer cancel()
+
+	introspector, conn, err := m.open(ctx, tc.id)
+
+	m.mu.Lock()
+	tc.introspector = introspector
+	tc.conn = conn
+	tc.err = err
+	if err != nil {
+		tc.retryAt = time.Now().Add(m.cfg.FailureTTL)
+	}
+	if conn != nil {
+		conn.manager = m
+		conn.tc = tc
+	}
+	tc.done = true
+	close(tc.ready)
+	// Evicted while connecting and nobody is waiting anymore
+	closing := m.closableLocked(tc)
+	m.mu.Unlock()
+
+	if err != nil {
+		slog.WarnContext(ctx, "Tenant database unavailable", "tenant", tc.id, "error", err)
+	}
+	if closing {
+		closeAll([]*mysql.Introspector{introspector})
+	}
+}
+
+func (m *Manager) open(ctx context.Context, id string) (*mysql.Introspector, *Conn, error) {
+	dbCfg := m.dbConfig
+	dbCfg.Name = m.DatabaseName(id)
+
+	introspector := mysql.NewIntrospector(&dbCfg)
+	if err := introspector.Connect(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to tenant database %s: %w", dbCfg.Name, err)
+	}
+
+	schema := m.shared
+	if !m.cfg.SharedSchema {
+		loaded, err := introspector.LoadSchema(ctx)
+		if err != nil {
+			introspector.Close()
+			return nil, nil, fmt.Errorf("failed to load schema for tenant database %s: %w", dbCfg.Name, err)
+		}
+		schema = loaded
+	}
+
+	return introspector, &Conn{DB: introspector.GetDB(), Schema: schema}, nil
+}
+
+// evictLocked removes the least recently used tenants until a new one fits
+// and returns the introspectors to close outside the lock. Pools still in
+// use are closed by the release of their last reference instead.
+func (m *Manager) evictLocked() []*mysql.Introspector {
+	var evicted []*mysql.Introspector
+	for m.cfg.MaxDatabases > 0 && len(m.tenants) >= m.cfg.MaxDatabases {
+		oldest := m.lru.Back().Value.(*tenantConn)
+		m.removeLocked(oldest)
+		if m.closableLocked(oldest) {
+			evicted = append(evicted, oldest.introspector)
+		}
+	}
+	return evicted
+}
+
+func (m *Manager) removeLocked(tc *tenantConn) {
+	delete(m.tenants, tc.id)
+	m.lru.Remove(tc.elem)
+	tc.removed = true
+}
+
+// Close closes every pool, including those still in use. It is called once
+// the server stopped serving requests.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	var errs []error
+	for id, tc := range m.tenants {
+		m.removeLocked(tc)
+		if tc.done && !tc.closed && tc.introspector != nil {
+			tc.closed = true
+			if err := tc.introspector.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", id, err))
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("tenant close errors: %v", errs)
+	}
+	return nil
+}
+
+func closeAll(introspectors []*mysql.Introspector) {
+	for _, introspector := range introspectors {
+		if err := introspector.Close(); err != nil {
+			slog.Warn("Failed to close tenant database", "error", err)
+		}
+	}
+}
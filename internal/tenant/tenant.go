@@ -0,0 +1,153 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/database/mysql"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+// validID restricts tenant identifiers to characters that are safe to use
+// in database names and cache keys
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant ID
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID stored by WithTenant
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Resolver determines the tenant of a request from a JWT claim, a header or
+// the request subdomain, and in schema mode hands out the tenant connection
+type Resolver struct {
+	cfg     *config.TenancyConfig
+	manager *Manager
+}
+
+func NewResolver(cfg *config.TenancyConfig, dbCfg *config.DatabaseConfig, shared *mysql.SchemaCache) *Resolver {
+	tr := &Resolver{
+		cfg: cfg,
+	}
+
+	if cfg.Enabled && cfg.Mode == "schema" {
+		tr.manager = NewManager(cfg, dbCfg, shared)
+	}
+
+	return tr
+}
+
+func (tr *Resolver) Enabled() bool {
+	return tr != nil && tr.cfg.Enabled
+}
+
+// Conn returns the connection of tenant id in schema mode, or nil when all
+// tenants share the main database. The caller has to release it.
+func (tr *Resolver) Conn(ctx context.Context, id string) (*Conn, error) {
+	if tr == nil || tr.manager == nil {
+		return nil, nil
+	}
+	return tr.manager.Conn(ctx, id)
+}
+
+func (tr *Resolver) Close() error {
+	if tr == nil || tr.manager == nil {
+		return nil
+	}
+	return tr.manager.Close()
+}
+
+// Column returns the tenant column in column mode, or "" otherwise
+func (tr *Resolver) Column() string {
+	if !tr.Enabled() || tr.cfg.Mode != "column" {
+		return ""
+	}
+	return tr.cfg.Column
+}
+
+// Resolve returns the tenant ID of r. A tenant taken from a header or the
+// subdomain is chosen by the client, so an authenticated caller has to be
+// bound to that tenant by its token or API key.
+func (tr *Resolver) Resolve(r *http.Request) (string, error) {
+	var id string
+	claims, authenticated := security.ClaimsFromContext(r.Context())
+
+	switch tr.cfg.Source {
+	case "claim":
+		bound, ok := tr.boundTenant(claims)
+		if !ok {
+			return "", ErrNoTenant
+		}
+		id = bound
+	case "header":
+		id = strings.TrimSpace(r.Header.Get(tr.cfg.Header))
+	case "subdomain":
+		id = subdomain(r.Host, tr.cfg.BaseDomain)
+	}
+
+	if id == "" {
+		return "", ErrNoTenant
+	}
+	if !validID.MatchString(id) {
+		return "", ErrInvalidTenant
+	}
+
+	if tr.cfg.Source != "claim" && authenticated {
+		if bound, ok := tr.boundTenant(claims); !ok || bound != id {
+			return "", ErrTenantMismatch
+		}
+	}
+
+	return id, nil
+}
+
+// boundTenant returns the tenant of the caller: the configured claim of its
+// token, or the tenant mapped from the token or set on its API key
+func (tr *Resolver) boundTenant(claims *security.Claims) (string, bool) {
+	if value, ok := claims.Claim(tr.cfg.Claim); ok {
+		return fmt.Sprint(value), true
+	}
+	if claims != nil && claims.TenantID != "" {
+		return claims.TenantID, true
+	}
+	return "", false
+}
+
+// subdomain returns the label in front of baseDomain, e.g. "acme" for
+// "acme.api.example.com" with base domain "api.example.com"
+func subdomain(host, baseDomain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+
+	label := strings.TrimSuffix(host, suffix)
+	if strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+var (
+	ErrNoTenant       = errors.New("tenant could not be resolved")
+	ErrInvalidTenant  = errors.New("invalid tenant identifier")
+	ErrTenantMismatch = errors.New("tenant is not the one of the token or API key")
+)
@@ -0,0 +1,161 @@
+package tenant
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/proyaai/instantgate/internal/config"
+	"github.com/proyaai/instantgate/internal/security"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		header  string
+		host    string
+		claims  *security.Claims
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "claim",
+			source: "claim",
+			claims: &security.Claims{Raw: map[string]interface{}{"tenant_id": "acme"}},
+			want:   "acme",
+		},
+		{
+			name:   "claim mapped from the token",
+			source: "claim",
+			claims: &security.Claims{TenantID: "acme"},
+			want:   "acme",
+		},
+		{
+			name:    "claim missing",
+			source:  "claim",
+			claims:  &security.Claims{UserID: "1"},
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "claim without token",
+			source:  "claim",
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "claim with invalid identifier",
+			source:  "claim",
+			claims:  &security.Claims{TenantID: "../etc"},
+			wantErr: ErrInvalidTenant,
+		},
+		{
+			name:   "header without token",
+			source: "header",
+			header: "acme",
+			want:   "acme",
+		},
+		{
+			name:   "header matching token",
+			source: "header",
+			header: "acme",
+			claims: &security.Claims{TenantID: "acme"},
+			want:   "acme",
+		},
+		{
+			name:    "header differing from token",
+			source:  "header",
+			header:  "globex",
+			claims:  &security.Claims{TenantID: "acme"},
+			wantErr: ErrTenantMismatch,
+		},
+		{
+			name:    "header with token lacking the claim",
+			source:  "header",
+			header:  "globex",
+			claims:  &security.Claims{UserID: "1"},
+			wantErr: ErrTenantMismatch,
+		},
+		{
+			name:    "header with API key bound to another tenant",
+			source:  "header",
+			header:  "globex",
+			claims:  &security.Claims{UserID: "apikey:billing", TenantID: "acme", TokenType: "api_key"},
+			wantErr: ErrTenantMismatch,
+		},
+		{
+			name:    "header missing",
+			source:  "header",
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "header with invalid identifier",
+			source:  "header",
+			header:  "acme corp",
+			wantErr: ErrInvalidTenant,
+		},
+		{
+			name:   "subdomain",
+			source: "subdomain",
+			host:   "Acme.api.example.com:8080",
+			want:   "acme",
+		},
+		{
+			name:    "subdomain nested",
+			source:  "subdomain",
+			host:    "a.acme.api.example.com",
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "subdomain of another domain",
+			source:  "subdomain",
+			host:    "acme.example.org",
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "subdomain differing from token",
+			source:  "subdomain",
+			host:    "globex.api.example.com",
+			claims:  &security.Claims{TenantID: "acme"},
+			wantErr: ErrTenantMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewResolver(&config.TenancyConfig{
+				Enabled:    true,
+				Mode:       "column",
+				Source:     tt.source,
+				Claim:      "tenant_id",
+				Header:     "X-Tenant-ID",
+				BaseDomain: "api.example.com",
+				Column:     "tenant_id",
+			}, &config.DatabaseConfig{}, nil)
+
+			r := httptest.NewRequest("GET", "/api/orders", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if tt.claims != nil {
+				r = r.WithContext(security.WithClaims(r.Context(), tt.claims))
+			}
+
+			got, err := tr.Resolve(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// Exporter sends batches of finished spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Close() error
+}
+
+// NewExporter creates the exporter selected by cfg.Exporter
+func NewExporter(cfg *config.TracingConfig) (Exporter, error) {
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "otlp":
+		return NewOTLPExporter(cfg.Endpoint, cfg.Headers, cfg.ServiceName), nil
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		return NewWriterExporter(f, cfg.ServiceName), nil
+	case "stdout":
+		return NewWriterExporter(nopCloser{os.Stdout}, cfg.ServiceName), nil
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter: %s", cfg.Exporter)
+	}
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP endpoint using the JSON encoding,
+// e.g. http://localhost:4318/v1/traces of an OpenTelemetry Collector
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+}
+
+func NewOTLPExporter(endpoint string, headers map[string]string, service string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(spans, e.service))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// WriterExporter writes each batch as one line of OTLP JSON, the format of
+// the OpenTelemetry Collector file exporter, for offline inspection
+type WriterExporter struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	service string
+}
+
+func NewWriterExporter(w io.WriteCloser, service string) *WriterExporter {
+	return &WriterExporter{w: w, service: service}
+}
+
+func (e *WriterExporter) Export(ctx context.Context, spans []*Span) error {
+	line, err := json.Marshal(encodeSpans(spans, e.service))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(line)
+	return err
+}
+
+func (e *WriterExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.w.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// OTLP JSON messages, see opentelemetry-proto trace/v1. IDs are hex encoded
+// and 64 bit integers are strings.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// statusError is STATUS_CODE_ERROR
+const statusError = 2
+
+func encodeSpans(spans []*Span, service string) otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, encodeSpan(span))
+	}
+
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			encodeAttribute("service.name", service),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/proyaai/instantgate"},
+			Spans: encoded,
+		}},
+	}}}
+}
+
+func encodeSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	s := otlpSpan{
+		TraceID:           span.ctx.TraceID.String(),
+		SpanID:            span.ctx.SpanID.String(),
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: unixNano(span.start),
+		EndTimeUnixNano:   unixNano(span.end),
+	}
+	if span.parent.IsValid() {
+		s.ParentSpanID = span.parent.String()
+	}
+	if span.errMessage != "" {
+		s.Status = &otlpStatus{Code: statusError, Message: span.errMessage}
+	}
+
+	keys := make([]string, 0, len(span.attributes))
+	for key := range span.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.Attributes = append(s.Attributes, encodeAttribute(key, span.attributes[key]))
+	}
+
+	return s
+}
+
+func encodeAttribute(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.FormatInt(int64(value), 10)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := attributeString(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+// attributeString formats values of types OTLP has no representation for
+func attributeString(value interface{}) string {
+	if s, ok := value.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
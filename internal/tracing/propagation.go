@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader carries the span context as defined by W3C Trace Context
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent reads a traceparent header such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". Invalid headers
+// yield an invalid SpanContext, so a new trace is started.
+func ParseTraceparent(header string) SpanContext {
+	header = strings.TrimSpace(header)
+	// Later versions may append fields; version 00 has exactly four
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return SpanContext{}
+	}
+
+	parts := strings.SplitN(header[:55], "-", 4)
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(header) != 55) {
+		return SpanContext{}
+	}
+
+	var version, flags [1]byte
+	var sc SpanContext
+	if !decodeLowerHex(version[:], parts[0]) ||
+		!decodeLowerHex(sc.TraceID[:], parts[1]) ||
+		!decodeLowerHex(sc.SpanID[:], parts[2]) ||
+		!decodeLowerHex(flags[:], parts[3]) {
+		return SpanContext{}
+	}
+	if !sc.IsValid() {
+		return SpanContext{}
+	}
+
+	sc.Sampled = flags[0]&0x01 == 1
+	return sc
+}
+
+// FormatTraceparent writes sc as a version 00 traceparent header
+func FormatTraceparent(sc SpanContext) string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// decodeLowerHex decodes s into dst; the specification only allows lower
+// case hex digits
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import "regexp"
+
+// literalPattern matches quoted strings and numbers outside of identifiers
+var literalPattern = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"|\b\d+(?:\.\d+)?\b`)
+
+// SanitizeSQL replaces literals in stmt, such as inlined limits, with ? so
+// span attributes never carry values. Identifiers in backticks are kept.
+func SanitizeSQL(stmt string) string {
+	var out []byte
+	last := 0
+	inIdent := false
+	for i := 0; i < len(stmt); i++ {
+		if stmt[i] != '`' {
+			continue
+		}
+		if !inIdent {
+			out = append(out, literalPattern.ReplaceAllString(stmt[last:i], "?")...)
+			last = i
+		} else {
+			out = append(out, stmt[last:i+1]...)
+			last = i + 1
+		}
+		inIdent = !inIdent
+	}
+
+	if inIdent {
+		return string(append(out, stmt[last:]...))
+	}
+	return string(append(out, literalPattern.ReplaceAllString(stmt[last:], "?")...))
+}
@@ -0,0 +1,341 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/proyaai/instantgate/internal/config"
+)
+
+// TraceID and SpanID identify spans as in W3C Trace Context
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext is the part of a span propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind follows the OTLP numbering
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is a timed operation of a trace. Spans of unsampled traces carry
+// their IDs for propagation but are not exported. A nil *Span ignores every
+// call, so callers do not need to check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+	ctx    SpanContext
+	parent SpanID
+	kind   SpanKind
+
+	mu         sync.Mutex
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	errMessage string
+	ended      bool
+}
+
+// Context returns the IDs of the span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetName replaces the name given at start, e.g. once the route is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr records an attribute. Values are strings, bools, integers or
+// floats; other values are formatted with fmt.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil || !s.ctx.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Later calls are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.ctx.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span of ctx or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a child of the span in ctx. Without a span in ctx, e.g. for
+// work outside of a request or with tracing disabled, it returns ctx and a
+// nil span.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := parent.tracer.newSpan(name, kind, parent.ctx.TraceID, parent.ctx.SpanID, parent.ctx.Sampled)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Tracer starts root spans and exports finished spans in batches
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	// trustRemote keeps the sampled flag of incoming traceparent headers
+	trustRemote bool
+
+	queue   chan *Span
+	dropped uint64
+	mu      sync.Mutex
+	done    chan struct{}
+	closed  bool
+}
+
+const (
+	queueSize     = 4096
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// New creates the tracer configured by cfg, or returns nil when tracing is
+// disabled
+func New(cfg *config.TracingConfig) (*Tracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracer{
+		exporter:    exporter,
+		sampleRatio: cfg.SampleRatio,
+		trustRemote: cfg.TrustRemoteSampling,
+		queue:       make(chan *Span, queueSize),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+
+	return t, nil
+}
+
+// StartRequest begins the server span of a request. A valid remote parent
+// continues its trace; its sampling decision is kept only when remote
+// sampling is trusted, since any client can send a traceparent header.
+// Other traces are sampled by the configured ratio.
+func (t *Tracer) StartRequest(ctx context.Context, name string, remote SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	var span *Span
+	if remote.IsValid() {
+		sampled := remote.Sampled
+		if !t.trustRemote {
+			sampled = t.sample(remote.TraceID)
+		}
+		span = t.newSpan(name, KindServer, remote.TraceID, remote.SpanID, sampled)
+	} else {
+		traceID := newTraceID()
+		span = t.newSpan(name, KindServer, traceID, SpanID{}, t.sample(traceID))
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) newSpan(name string, kind SpanKind, traceID TraceID, parent SpanID, sampled bool) *Span {
+	span := &Span{
+		tracer: t,
+		ctx:    SpanContext{TraceID: traceID, SpanID: newSpanID(), Sampled: sampled},
+		parent: parent,
+		kind:   kind,
+		name:   name,
+		start:  time.Now(),
+	}
+	if sampled {
+		span.attributes = make(map[string]interface{})
+	}
+	return span
+}
+
+// sample decides by the trace ID so every service keeps the same traces
+func (t *Tracer) sample(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])) < t.sampleRatio*math.MaxUint64
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.queue <- span:
+	default:
+		// Spans are dropped rather than slowing down requests
+		t.dropped++
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				t.export(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				t.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			t.export(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (t *Tracer) export(batch []*Span) {
+	t.mu.Lock()
+	dropped := t.dropped
+	t.dropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		slog.Warn("Trace queue full, spans dropped", "dropped", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	if err := t.exporter.Export(ctx, batch); err != nil {
+		slog.Warn("Trace export failed", "error", err)
+	}
+}
+
+// Close exports the queued spans and releases the exporter
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	<-t.done
+	return t.exporter.Close()
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
@@ -4,9 +4,24 @@ import (
 	"fmt"
 )
 
+// Machine-readable validation error codes
+const (
+	CodeRequired = "required"
+	CodePattern  = "pattern"
+	CodeMin      = "min"
+	CodeMax      = "max"
+	CodeEnum     = "enum"
+	CodeLength   = "length"
+	CodeType     = "type"
+	CodeUnknown  = "unknown"
+	CodeReadOnly = "read_only"
+)
+
 type ValidationError struct {
 	Field   string
+	Code    string
 	Message string
+	Params  map[string]interface{}
 }
 
 func (ve *ValidationError) Error() string {
@@ -41,10 +56,25 @@ func (ve ValidationErrors) HasErrors() bool {
 	return len(ve) > 0
 }
 
+// ByField groups the error messages by field name
+func (ve ValidationErrors) ByField() map[string][]string {
+	fields := make(map[string][]string, len(ve))
+	for _, err := range ve {
+		fields[err.Field] = append(fields[err.Field], err.Message)
+	}
+	return fields
+}
+
 func NewValidationError(field, message string) *ValidationError {
 	return &ValidationError{Field: field, Message: message}
 }
 
+// NewCodedError creates a validation error carrying a machine-readable code
+// and the rule parameters that produced it
+func NewCodedError(field, code, message string, params map[string]interface{}) *ValidationError {
+	return &ValidationError{Field: field, Code: code, Message: message, Params: params}
+}
+
 var (
 	ErrTableNotFound     = fmt.Errorf("table not found")
 	ErrColumnNotFound    = fmt.Errorf("column not found")
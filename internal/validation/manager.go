@@ -1,6 +1,8 @@
 package validation
 
 import (
+	"sort"
+
 	"github.com/proyaai/instantgate/internal/config"
 	"github.com/proyaai/instantgate/internal/database/mysql"
 )
@@ -21,27 +23,19 @@ func NewValidationManager(cfg *config.ValidationConfig, schemaCache *mysql.Schem
 	}
 }
 
+// WithSchema returns a manager that validates against schemaCache, used when
+// each tenant has its own database schema
+func (vm *ValidationManager) WithSchema(schemaCache *mysql.SchemaCache) *ValidationManager {
+	scoped := *vm
+	scoped.schemaCache = schemaCache
+	scoped.schemaValidator = NewSchemaValidator(schemaCache, vm.config.StrictMode)
+	return &scoped
+}
+
 // Validate performs schema-based and rule-based validation
 func (vm *ValidationManager) Validate(tableName string, data map[string]interface{}, operation Operation) error {
-	// Validation kapalıysa skip et
-	if !vm.config.Enabled {
-		return nil
-	}
-
-	var allErrors ValidationErrors
-
-	// 1. Schema-based validation (otomatik: tip, uzunluk, null kontrolü)
-	if schemaErrs := vm.schemaValidator.Validate(tableName, data, operation); schemaErrs.HasErrors() {
-		allErrors = append(allErrors, schemaErrs...)
-	}
-
-	// 2. Rule-based validation (config.yaml kuralları: regex, min/max, enum)
-	if ruleErrs := vm.ruleValidator.Validate(tableName, data); ruleErrs.HasErrors() {
-		allErrors = append(allErrors, ruleErrs...)
-	}
-
-	if allErrors.HasErrors() {
-		// İlk hatayı döndür (ileride tüm hataları döndürmeye genişletilebilir)
+	if allErrors := vm.ValidateMultiple(tableName, data, operation); allErrors.HasErrors() {
+		// İlk hatayı döndür; tüm hatalar için ValidateMultiple kullanın
 		return allErrors[0]
 	}
 
@@ -50,19 +44,27 @@ func (vm *ValidationManager) Validate(tableName string, data map[string]interfac
 
 // ValidateMultiple returns all validation errors instead of just the first one
 func (vm *ValidationManager) ValidateMultiple(tableName string, data map[string]interface{}, operation Operation) ValidationErrors {
+	// Validation kapalıysa skip et
 	if !vm.config.Enabled {
 		return nil
 	}
 
 	var allErrors ValidationErrors
 
+	// 1. Schema-based validation (otomatik: tip, uzunluk, null kontrolü)
 	if schemaErrs := vm.schemaValidator.Validate(tableName, data, operation); schemaErrs.HasErrors() {
 		allErrors = append(allErrors, schemaErrs...)
 	}
 
+	// 2. Rule-based validation (config.yaml kuralları: regex, min/max, enum)
 	if ruleErrs := vm.ruleValidator.Validate(tableName, data); ruleErrs.HasErrors() {
 		allErrors = append(allErrors, ruleErrs...)
 	}
 
+	// Map iteration order is random; keep responses stable
+	sort.SliceStable(allErrors, func(i, j int) bool {
+		return allErrors[i].Field < allErrors[j].Field
+	})
+
 	return allErrors
 }
@@ -69,11 +69,11 @@ func (rv *RuleValidator) validateRule(field string, value interface{}, exists bo
 
 func (rv *RuleValidator) validateRequired(field string, value interface{}, exists bool, rule config.RuleItem) *ValidationError {
 	if !exists || value == nil {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' is required", field)))
+		return NewCodedError(field, CodeRequired, rv.getMessage(rule, fmt.Sprintf("'%s' is required", field)), nil)
 	}
 
 	if str, ok := value.(string); ok && strings.TrimSpace(str) == "" {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' cannot be empty", field)))
+		return NewCodedError(field, CodeRequired, rv.getMessage(rule, fmt.Sprintf("'%s' cannot be empty", field)), nil)
 	}
 
 	return nil
@@ -95,7 +95,8 @@ func (rv *RuleValidator) validateRegex(field string, value interface{}, exists b
 	}
 
 	if !pattern.MatchString(str) {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' does not match the required pattern", field)))
+		return NewCodedError(field, CodePattern, rv.getMessage(rule, fmt.Sprintf("'%s' does not match the required pattern", field)),
+			map[string]interface{}{"pattern": rule.Pattern})
 	}
 
 	return nil
@@ -117,7 +118,8 @@ func (rv *RuleValidator) validateMin(field string, value interface{}, exists boo
 	}
 
 	if numValue < minValue {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' must be at least %v", field, rule.Value)))
+		return NewCodedError(field, CodeMin, rv.getMessage(rule, fmt.Sprintf("'%s' must be at least %v", field, rule.Value)),
+			map[string]interface{}{"min": rule.Value})
 	}
 
 	return nil
@@ -139,7 +141,8 @@ func (rv *RuleValidator) validateMax(field string, value interface{}, exists boo
 	}
 
 	if numValue > maxValue {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' must be at most %v", field, rule.Value)))
+		return NewCodedError(field, CodeMax, rv.getMessage(rule, fmt.Sprintf("'%s' must be at most %v", field, rule.Value)),
+			map[string]interface{}{"max": rule.Value})
 	}
 
 	return nil
@@ -161,7 +164,8 @@ func (rv *RuleValidator) validateEnum(field string, value interface{}, exists bo
 		}
 	}
 
-	return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' must be one of: %s", field, strings.Join(rule.Values, ", "))))
+	return NewCodedError(field, CodeEnum, rv.getMessage(rule, fmt.Sprintf("'%s' must be one of: %s", field, strings.Join(rule.Values, ", "))),
+		map[string]interface{}{"values": rule.Values})
 }
 
 func (rv *RuleValidator) validateLength(field string, value interface{}, exists bool, rule config.RuleItem) *ValidationError {
@@ -180,7 +184,8 @@ func (rv *RuleValidator) validateLength(field string, value interface{}, exists
 	}
 
 	if len(str) > int(maxLen) {
-		return NewValidationError(field, rv.getMessage(rule, fmt.Sprintf("'%s' must be at most %d characters", field, int(maxLen))))
+		return NewCodedError(field, CodeLength, rv.getMessage(rule, fmt.Sprintf("'%s' must be at most %d characters", field, int(maxLen))),
+			map[string]interface{}{"max": int(maxLen)})
 	}
 
 	return nil
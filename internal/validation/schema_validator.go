@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -31,7 +32,7 @@ func (sv *SchemaValidator) Validate(tableName string, data map[string]interface{
 	for field := range data {
 		if _, ok := tableSchema.Columns[strings.ToLower(field)]; !ok {
 			if sv.strictMode {
-				errs = append(errs, NewValidationError(field, fmt.Sprintf("Unknown column '%s' in table '%s'", field, tableName)))
+				errs = append(errs, NewCodedError(field, CodeUnknown, fmt.Sprintf("Unknown column '%s' in table '%s'", field, tableName), nil))
 			}
 		}
 	}
@@ -55,7 +56,7 @@ func (sv *SchemaValidator) Validate(tableName string, data map[string]interface{
 		}
 
 		if err := query.ValidateColumn(col, value); err != nil {
-			errs = append(errs, NewValidationError(field, err.Error()))
+			errs = append(errs, columnError(field, err))
 		}
 	}
 
@@ -74,10 +75,27 @@ func (sv *SchemaValidator) Validate(tableName string, data map[string]interface{
 			}
 
 			if !found {
-				errs = append(errs, NewValidationError(col.Name, fmt.Sprintf("Column '%s' is required and does not allow NULL", col.Name)))
+				errs = append(errs, NewCodedError(col.Name, CodeRequired, fmt.Sprintf("Column '%s' is required and does not allow NULL", col.Name), nil))
 			}
 		}
 	}
 
 	return errs
-}
\ No newline at end of file
+}
+
+// columnError converts a query.ColumnError into a coded validation error
+func columnError(field string, err error) *ValidationError {
+	var colErr *query.ColumnError
+	if !errors.As(err, &colErr) {
+		return NewCodedError(field, CodeType, err.Error(), nil)
+	}
+
+	switch colErr.Kind {
+	case "required":
+		return NewCodedError(field, CodeRequired, colErr.Message, nil)
+	case "length":
+		return NewCodedError(field, CodeLength, colErr.Message, map[string]interface{}{"max": colErr.Max})
+	default:
+		return NewCodedError(field, CodeType, colErr.Message, map[string]interface{}{"expected": colErr.Expected})
+	}
+}